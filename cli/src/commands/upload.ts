@@ -5,6 +5,11 @@ import { loadConfig } from "../config";
 interface UploadOptions {
   raw?: boolean;
   type?: string;
+  stripMetadata?: boolean;
+  theme?: string;
+  noPreview?: boolean;
+  expires?: string;
+  maxViews?: string;
 }
 
 export async function upload(
@@ -32,23 +37,17 @@ export async function upload(
     filename = basename(fileOrStdin);
     contentType = contentType || detectContentType(filename);
   } else if (fileOrStdin === "-" || !process.stdin.isTTY) {
-    // Read from stdin
-    const stdin = await Bun.stdin.text();
-    body = stdin;
-    contentType = contentType || "text/plain";
+    // Read from stdin as bytes, the server detects the type from them
+    body = new Uint8Array(await Bun.stdin.arrayBuffer());
   } else {
     console.error(`File not found: ${fileOrStdin}`);
     process.exit(1);
   }
 
-  // Build URL with query params
-  const url = new URL("/api/upload", config.server);
+  const url = uploadURL(config.server, options);
   if (filename) {
     url.searchParams.set("filename", filename);
   }
-  if (options.raw) {
-    url.searchParams.set("render", "raw");
-  }
 
   try {
     const response = await fetch(url.toString(), {
@@ -75,15 +74,87 @@ export async function upload(
   }
 }
 
+// Builds the upload URL with the options shared by all uploads
+function uploadURL(server: string, options: UploadOptions): URL {
+  const url = new URL("/api/upload", server);
+  if (options.raw) {
+    url.searchParams.set("render", "raw");
+  }
+  if (options.stripMetadata !== undefined) {
+    url.searchParams.set("strip_metadata", String(options.stripMetadata));
+  }
+  if (options.theme) {
+    url.searchParams.set("theme", options.theme);
+  }
+  if (options.noPreview) {
+    url.searchParams.set("no_preview", "true");
+  }
+  if (options.expires) {
+    url.searchParams.set("expires", options.expires);
+  }
+  if (options.maxViews) {
+    url.searchParams.set("max_views", options.maxViews);
+  }
+  return url;
+}
+
+// Uploads several files in one request, shared together as a collection
+// with a page listing them and a zip of all of them
+export async function uploadFiles(
+  files: string[],
+  options: UploadOptions
+): Promise<void> {
+  const config = await loadConfig();
+
+  if (!config.token) {
+    console.error("No token configured. Set SHARE_TOKEN or configure ~/.config/share/config.yaml");
+    process.exit(1);
+  }
+
+  const form = new FormData();
+  for (const path of files) {
+    if (!existsSync(path) || !statSync(path).isFile()) {
+      console.error(`File not found: ${path}`);
+      process.exit(1);
+    }
+    const name = basename(path);
+    const type = options.type || detectContentType(name);
+    form.append("file", new File([Bun.file(path)], name, { type }));
+  }
+
+  try {
+    const response = await fetch(uploadURL(config.server, options).toString(), {
+      method: "POST",
+      headers: {
+        "Authorization": `Bearer ${config.token}`,
+      },
+      body: form,
+    });
+
+    if (!response.ok) {
+      const text = await response.text();
+      console.error(`Upload failed: ${response.status} ${text}`);
+      process.exit(1);
+    }
+
+    process.stdout.write(await response.text());
+  } catch (e: any) {
+    console.error(`Upload failed: ${e.message}`);
+    process.exit(1);
+  }
+}
+
 function detectContentType(filename: string): string {
   const ext = extname(filename).toLowerCase();
 
   const mimeTypes: Record<string, string> = {
     // Text/Code
     ".txt": "text/plain",
+    ".log": "text/plain",
     ".md": "text/markdown",
     ".markdown": "text/markdown",
     ".json": "application/json",
+    ".ipynb": "application/x-ipynb+json",
     ".yaml": "text/yaml",
     ".yml": "text/yaml",
     ".toml": "text/toml",
@@ -110,6 +181,9 @@ function detectContentType(filename: string): string {
     ".cs": "text/x-csharp",
     ".php": "text/x-php",
     ".swift": "text/x-swift",
+    ".diff": "text/x-diff",
+    ".patch": "text/x-diff",
+    ".cast": "application/x-asciicast",
 
     // Images
     ".png": "image/png",
@@ -1,6 +1,6 @@
 #!/usr/bin/env bun
 import { parseArgs } from "util";
-import { upload } from "./commands/upload";
+import { upload, uploadFiles } from "./commands/upload";
 import { list } from "./commands/list";
 import { deleteItem } from "./commands/delete";
 
@@ -12,11 +12,24 @@ const { values, positionals } = parseArgs({
     raw: { type: "boolean", short: "r" },
     type: { type: "string", short: "t" },
     server: { type: "string", short: "s" },
+    "strip-metadata": { type: "boolean" },
+    "keep-metadata": { type: "boolean" },
+    theme: { type: "string" },
+    "no-preview": { type: "boolean" },
+    expires: { type: "string" },
+    "max-views": { type: "string" },
   },
   allowPositionals: true,
   strict: false,
 });
 
+// Image metadata option, undefined leaves it to the server default
+function stripMetadataOption(): boolean | undefined {
+  if (values["strip-metadata"]) return true;
+  if (values["keep-metadata"]) return false;
+  return undefined;
+}
+
 async function main() {
   if (values.version) {
     console.log("share v0.1.0");
@@ -47,6 +60,11 @@ async function main() {
     await upload("-", {
       raw: values.raw as boolean,
       type: values.type as string,
+      stripMetadata: stripMetadataOption(),
+      theme: values.theme as string,
+      noPreview: values["no-preview"] as boolean,
+      expires: values.expires as string,
+      maxViews: values["max-views"] as string,
     });
     return;
   }
@@ -64,12 +82,23 @@ async function main() {
       }
       await deleteItem(positionals[1]);
       break;
-    default:
-      // Treat as file upload
-      await upload(command, {
+    default: {
+      // Treat as file upload, several files are shared as a collection
+      const options = {
         raw: values.raw as boolean,
         type: values.type as string,
-      });
+        stripMetadata: stripMetadataOption(),
+        theme: values.theme as string,
+        noPreview: values["no-preview"] as boolean,
+        expires: values.expires as string,
+        maxViews: values["max-views"] as string,
+      };
+      if (positionals.length > 1) {
+        await uploadFiles(positionals, options);
+      } else {
+        await upload(command, options);
+      }
+    }
   }
 }
 
@@ -83,18 +112,24 @@ DESCRIPTION:
 
 COMMANDS:
   share <file>                Upload file, print URL to stdout
-  share <file1> <file2> ...   Upload multiple files (not yet supported)
+  share <file1> <file2> ...   Upload files together, print the collection URL
   share list                  List all uploads for current token
   share delete <id>           Delete upload by ID (24-char hex string)
   share info <id>             Show upload metadata (not yet supported)
 
 STDIN:
-  <command> | share           Upload piped content as text/plain
+  <command> | share           Upload piped content, its type detected by the server
   share -                     Explicit stdin read
 
 OPTIONS:
   -r, --raw                   Set default view to raw (no rendering)
   -t, --type <mime>           Force content-type (e.g., text/markdown)
+  --strip-metadata            Remove EXIF/GPS metadata from images
+  --keep-metadata             Keep image metadata (overrides server default)
+  --theme <name>              Color theme of the rendered view: dark, light or auto
+  --no-preview                Show a bare link when pasted into chat apps
+  --expires <duration>        Remove after a duration, e.g. 1h or 7d
+  --max-views <n>             Remove after being opened n times
   -s, --server <url>          Override server URL for this command
   -h, --help                  Show this help message
   -v, --version               Show version number
@@ -112,6 +147,7 @@ URL STRUCTURE:
   /<id>                       View with default rendering
   /<id>/raw                   Download original file
   /<id>/render                Force rendered view (markdown/code)
+  /<id>?theme=light           View in another theme (dark, light or auto)
 
 CONFIGURATION:
   File: ~/.config/share/config.yaml
@@ -135,7 +171,8 @@ AUTHENTICATION:
 CONTENT TYPES:
   Auto-detected from file extension. Override with --type flag.
   Rendered in browser: .md, .txt, .json, .yaml, .py, .js, .ts, .go, etc.
-  Served as-is: images, PDFs, binaries, HTML
+  Image viewer: .png, .jpg, .gif, .webp, .svg
+  Served as-is: PDFs, binaries, HTML
 
 EXAMPLES:
   # Upload a markdown file
@@ -148,6 +185,9 @@ EXAMPLES:
   # Upload code without syntax highlighting
   share --raw script.py
 
+  # Share a phone photo without its GPS location
+  share --strip-metadata IMG_1234.jpg
+
   # Pipe command output
   kubectl get pods | share
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Fileri/share/server/internal/api"
 	"github.com/Fileri/share/server/internal/config"
+	"github.com/Fileri/share/server/internal/render"
 	"github.com/Fileri/share/server/internal/storage"
 )
 
@@ -23,6 +24,13 @@ func main() {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 
+	// Load branding for rendered pages
+	if cfg.Render.BrandingDir != "" {
+		if err := render.LoadBranding(cfg.Render.BrandingDir); err != nil {
+			log.Fatalf("Failed to load branding: %v", err)
+		}
+	}
+
 	// Create API handler
 	handler := api.New(cfg, store)
 
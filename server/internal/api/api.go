@@ -1,31 +1,67 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/cache"
 	"github.com/Fileri/share/server/internal/config"
+	"github.com/Fileri/share/server/internal/imaging"
+	"github.com/Fileri/share/server/internal/jobs"
+	"github.com/Fileri/share/server/internal/preview"
 	"github.com/Fileri/share/server/internal/render"
 	"github.com/Fileri/share/server/internal/storage"
 )
 
+// textName is the derived artifact holding a document's extracted text
+const textName = "text.txt"
+
+// maxTextSource bounds the size of documents text is extracted from
+const maxTextSource = 100 * 1024 * 1024
+
 // Handler is the main API handler
 type Handler struct {
-	config      *config.Config
-	storage     storage.Storage
-	mux         *http.ServeMux
-	webdav      *WebDAVHandler
-	maxFileSize int64 // 0 means unlimited
+	config         *config.Config
+	storage        storage.Storage
+	mux            *http.ServeMux
+	webdav         *WebDAVHandler
+	maxFileSize    int64 // 0 means unlimited
+	renderOpts     render.Options
+	renderMaxSize  int64 // text above this shows its first previewLines lines, 0 means unlimited
+	archiveMaxSize int64 // archives above this are not opened to serve their files, 0 means unlimited
+	sitesMu        sync.Mutex
+	sites          map[string]*siteIndex // listings of static sites by item ID
+	previewLines   int
+	jobs           *jobs.Queue
+	previews       *preview.Generator  // nil if thumbnails are disabled
+	userContent    *url.URL            // nil if HTML hosting is disabled
+	cache          *cache.Cache        // nil if rendered pages are not cached
+	viewsMu        sync.Mutex          // serializes counting views of items with a view limit
+	uploads        storage.UploadStore // nil if the backend cannot stage resumable uploads
+	uploadExpiry   time.Duration       // how long unfinished resumable uploads are kept
+	uploadsMu      sync.Mutex
+	uploadsHeld    map[string]bool // resumable uploads written to by requests on this instance
+	keepRevisions  int             // previous versions kept of replaced items, negative for none
+	itemsMu        sync.Mutex      // serializes changes to the content and settings of items
 }
 
 // New creates a new API handler
@@ -36,10 +72,51 @@ func New(cfg *config.Config, store storage.Storage) *Handler {
 		config:      cfg,
 		storage:     store,
 		mux:         http.NewServeMux(),
-		webdav:      NewWebDAV(store, cfg.Auth.Tokens, maxFileSize),
+		webdav:      NewWebDAV(store, cfg.Auth.Tokens, maxFileSize, newLockSystem(cfg.WebDAV, store), cfg.Uploads.StripMetadata),
 		maxFileSize: maxFileSize,
+		renderOpts: render.Options{
+			HighlightMaxSize: parseSize(cfg.Render.HighlightMaxSize),
+			Diagrams:         cfg.Render.Diagrams,
+			Math:             cfg.Render.Math,
+			Theme:            cfg.Render.Theme,
+			ArchiveLimits: archive.Limits{
+				MaxEntries:   cfg.Archives.MaxEntries,
+				MaxEntrySize: parseSize(cfg.Archives.MaxEntrySize),
+				MaxTotalSize: parseSize(cfg.Archives.MaxTotalSize),
+			},
+		},
+		renderMaxSize:  parseSize(cfg.Render.MaxSize),
+		archiveMaxSize: parseSize(cfg.Archives.MaxSize),
+		sites:          make(map[string]*siteIndex),
+		previewLines:   cfg.Render.PreviewLines,
+		jobs:           jobs.NewQueue(cfg.Previews.Workers, 100),
+		userContent:    parseUserContentURL(cfg.UserContent.BaseURL),
+		uploads:        newUploadStore(store),
+		uploadsHeld:    make(map[string]bool),
+		keepRevisions:  cfg.Revisions.Keep,
+	}
+
+	h.uploadExpiry, _ = time.ParseDuration(cfg.Uploads.ResumableExpiry)
+	if h.uploadExpiry <= 0 {
+		h.uploadExpiry = 24 * time.Hour
+	}
+	if h.uploads != nil {
+		go h.uploadCleanupLoop()
 	}
 
+	if cfg.Previews.Enabled {
+		h.previews = preview.New(cfg.Previews, store)
+	}
+	if size := parseSize(cfg.Render.CacheSize); size > 0 || cfg.Render.CacheStorage {
+		var cacheStore storage.Storage
+		if cfg.Render.CacheStorage {
+			cacheStore = store
+		}
+		h.cache = cache.New(size, cacheStore)
+	}
+	h.webdav.onStored = h.itemStored
+	h.webdav.onDeleted = h.itemDeleted
+
 	h.setupRoutes()
 	return h
 }
@@ -75,9 +152,15 @@ func parseSize(s string) int64 {
 func (h *Handler) setupRoutes() {
 	h.mux.HandleFunc("/", h.handleRoot)
 	h.mux.HandleFunc("/api/upload", h.handleUpload)
+	h.mux.HandleFunc("/api/upload/", h.handleUpload)
 	h.mux.HandleFunc("/api/list", h.handleList)
 	h.mux.HandleFunc("/api/delete/", h.handleDelete)
+	h.mux.HandleFunc("/api/items/", h.handleItems)
+	h.mux.HandleFunc(tusPrefix, h.handleTus)
 	h.mux.HandleFunc("/robots.txt", h.handleRobots)
+	h.mux.HandleFunc("/install.sh", h.handleInstall)
+	h.mux.HandleFunc("/oembed", h.handleOEmbed)
+	h.mux.HandleFunc(render.AssetPrefix, h.handleAsset)
 	h.mux.Handle("/webdav/", h.webdav)
 }
 
@@ -87,8 +170,15 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
 	w.Header().Set("X-Frame-Options", "DENY")
 	w.Header().Set("Referrer-Policy", "no-referrer")
-	// CSP: Allow scripts from CDN for highlight.js, marked, DOMPurify
-	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' https://cdn.jsdelivr.net 'unsafe-inline'; style-src 'self' https://cdn.jsdelivr.net 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none';")
+	// CSP: Rendered views replace this with a policy allowing their inline blocks by hash.
+	// Scripts only come from the assets, so no shared file is ever run as one.
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src "+h.config.BaseURL+render.AssetPrefix+"; style-src 'self'; img-src 'self' data:; frame-ancestors 'none';")
+
+	// The usercontent domain only serves shared pages, never the API
+	if h.isUserContentHost(r) {
+		h.serveUserContent(w, r)
+		return
+	}
 
 	h.mux.ServeHTTP(w, r)
 }
@@ -96,6 +186,12 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleRoot(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
 
+	// curl -T uploads to /<filename>
+	if r.Method == http.MethodPut {
+		h.handleUpload(w, r)
+		return
+	}
+
 	// Root path - show simple info
 	if path == "/" {
 		w.Header().Set("Content-Type", "text/plain")
@@ -103,87 +199,461 @@ func (h *Handler) handleRoot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse path: /<id> or /<id>/raw or /<id>/render
+	// Parse path: /<id> or /<id>/raw, /<id>/render, /<id>/thumb or /<id>/text
 	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) == 0 || len(parts) > 2 {
+	if len(parts) == 0 {
 		http.NotFound(w, r)
 		return
 	}
 
 	id := parts[0]
+
+	// Expired shares are gone, opening the share itself counts as a view
+	opened := len(parts) == 1 || len(parts) == 2 && (parts[1] == "raw" || parts[1] == "render") || len(parts) > 2 && parts[1] == "v"
+	if !h.admit(w, r, id, opened) {
+		return
+	}
+
+	// Archive members: /<id>/file/<path>
+	if len(parts) > 2 && parts[1] == "file" {
+		h.serveArchiveMember(w, r, id, strings.Join(parts[2:], "/"))
+		return
+	}
+	// Previous versions: /<id>/v/<n> or /<id>/v/<n>/raw
+	if len(parts) > 2 && parts[1] == "v" {
+		h.serveRevision(w, r, id, parts[2:])
+		return
+	}
+	if len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
 	viewMode := ""
 	if len(parts) == 2 {
 		viewMode = parts[1]
 	}
 
+	if viewMode == "thumb" {
+		h.serveThumbnail(w, r, id)
+		return
+	}
+
+	if viewMode == "text" {
+		h.serveText(w, r, id)
+		return
+	}
+
 	h.serveFile(w, r, id, viewMode)
 }
 
 func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, id string, viewMode string) {
 	ctx := r.Context()
 
-	content, item, err := h.storage.Get(ctx, id)
+	item, err := h.storage.GetMeta(ctx, id)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
-	defer content.Close()
 
-	// Determine if we should render
-	shouldRender := false
+	// The original of a collection is the zip of its files
+	if item.ContentType == render.CollectionType && viewMode == "raw" {
+		h.serveCollectionZip(w, r, item)
+		return
+	}
+
+	// CSV/TSV download of the filtered and sorted rows
+	if format := r.URL.Query().Get("format"); format != "" && render.IsTable(item.ContentType) {
+		content, item, err := h.storage.Get(ctx, id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer content.Close()
+		h.serveTableExport(w, r, content, item, format)
+		return
+	}
+
+	// HTML pages are hosted on the usercontent domain, their source is
+	// shown only on request
+	if h.userContent != nil && isHTML(item.ContentType) && viewMode != "raw" && r.URL.Query().Get("as") == "" {
+		http.Redirect(w, r, h.userContentURL(id), http.StatusFound)
+		return
+	}
+
+	// Determine the view to render, if any
+	available := h.views(item)
+	views := available
+	var view render.Renderer
 	switch viewMode {
 	case "raw":
-		shouldRender = false
 	case "render":
-		shouldRender = true
+		if as := r.URL.Query().Get("as"); as != "" {
+			if view = findView(views, as); view == nil {
+				http.Error(w, "Unknown view", http.StatusNotFound)
+				return
+			}
+			// Only the chosen view, without fallbacks
+			views = []render.Renderer{view}
+		} else if len(views) > 0 {
+			view = views[0]
+		}
 	default:
-		// Use item's render mode preference
-		shouldRender = item.RenderMode != "raw" && render.CanRender(item.ContentType)
+		// Use item's render mode preference, pages are served as such
+		if item.RenderMode != "raw" && !isHTML(item.ContentType) && len(views) > 0 {
+			view = views[0]
+		}
 	}
 
-	if shouldRender {
-		// Read content for rendering
-		data, err := io.ReadAll(content)
-		if err != nil {
-			http.Error(w, "Failed to read content", http.StatusInternalServerError)
+	if view != nil {
+		opts := h.renderOpts
+		opts.Table = render.ParseTableView(r.URL.Query())
+		opts.DiffSplit = r.URL.Query().Get("layout") == "split"
+		opts.FileURL = "/" + id + "/file/"
+		opts.Theme = h.pageTheme(r, item)
+		if h.userContent != nil {
+			opts.SiteURL = h.userContentURL(id)
+		}
+		opts.LinkPreview = h.linkPreview(r.Context(), item)
+		opts.ViewURL = "/" + id + "/render"
+		opts.Revision = revisionNote(item)
+		for _, v := range available {
+			opts.Views = append(opts.Views, v.Name())
+		}
+
+		// Text too large to highlight or render in full is streamed
+		limits := view.Limits()
+		tooLarge := h.renderMaxSize > 0 && item.Size > h.renderMaxSize
+		if limits.Streams && (tooLarge || opts.HighlightMaxSize > 0 && item.Size > opts.HighlightMaxSize) {
+			h.streamText(w, r, item, view, opts, tooLarge)
 			return
 		}
 
-		rendered, err := render.Render(item.ContentType, data, item.Filename, id)
+		// Cached pages are served without fetching the content. Only the
+		// default page is kept in storage, pages varying with the query
+		// would add one object per distinct query.
+		key := h.renderKey(item, view, opts)
+		stored := r.URL.RawQuery == ""
+		if key != "" {
+			if page, ok := h.cache.Get(ctx, id, key, stored); ok {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Header().Set("Content-Security-Policy", view.Policy(opts))
+				w.Write(page)
+				return
+			}
+		}
+
+		// Read content for rendering, media players only link to it
+		var data []byte
+		if !limits.NoContent {
+			content, _, err := h.storage.Get(ctx, id)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			data, err = io.ReadAll(content)
+			content.Close()
+			if err != nil {
+				http.Error(w, "Failed to read content", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		// Later views are fallbacks for content the chosen one cannot show
+		rendered, used, err := render.RenderWith(views, item.ContentType, data, item.Filename, "/"+id+"/raw", opts)
 		if err != nil {
 			// Fall back to raw
-			w.Header().Set("Content-Type", item.ContentType)
-			w.Write(data)
+			h.serveRaw(w, r, id)
 			return
 		}
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", used.Policy(opts))
 		w.Write(rendered)
+
+		// Pages of a fallback view would be served with the chosen view's policy
+		if key != "" && used == view {
+			h.cachePage(id, key, rendered, stored)
+		}
 		return
 	}
 
-	// Serve raw file
+	h.serveRaw(w, r, id)
+}
+
+// serveRaw serves an item's content as it was uploaded
+func (h *Handler) serveRaw(w http.ResponseWriter, r *http.Request, id string) {
+	content, item, err := h.storage.Get(r.Context(), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+
+	setRawHeaders(w, item)
+	io.Copy(w, content)
+}
+
+// setRawHeaders sets the headers of content served as is, which keep active
+// content from running script on this origin
+func setRawHeaders(w http.ResponseWriter, item *storage.Item) {
 	w.Header().Set("Content-Type", item.ContentType)
+	if isActiveContent(item.ContentType) {
+		w.Header().Set("Content-Security-Policy", sandboxCSP)
+	}
+	// The PDF view falls back to embedding the browser's own viewer
+	if render.IsPDF(item.ContentType, "") {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'self'")
+	}
 	if item.Filename != "" {
 		// Safely format Content-Disposition to prevent header injection
 		disposition := mime.FormatMediaType("inline", map[string]string{"filename": item.Filename})
 		w.Header().Set("Content-Disposition", disposition)
 	}
-	io.Copy(w, content)
 }
 
+// streamText writes the code or log view of a text file as it is read from
+// storage. Files above the render limit are cut short after their first lines.
+func (h *Handler) streamText(w http.ResponseWriter, r *http.Request, item *storage.Item, view render.Renderer, opts render.Options, truncate bool) {
+	content, _, err := h.storage.Get(r.Context(), item.ID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+
+	var text io.Reader = content
+	maxLines := 0
+	if truncate {
+		text = io.LimitReader(content, h.renderMaxSize)
+		maxLines = h.previewLines
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", view.Policy(opts))
+	err = render.StreamText(w, view, item.ContentType, text, item.Size, item.Filename, "/"+item.ID+"/raw", maxLines, opts)
+	if errors.Is(err, render.ErrBinary) {
+		// Nothing was written, so the file can be served as is instead
+		w.Header().Del("Content-Security-Policy")
+		h.serveRaw(w, r, item.ID)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to stream %s: %v", item.ID, err)
+	}
+}
+
+// views returns the views of an item, the default first. Views are not
+// offered for content above their size limit or the server's, unless they
+// stream the start of it or do not read it at all.
+func (h *Handler) views(item *storage.Item) []render.Renderer {
+	var views []render.Renderer
+	for _, view := range render.Views(item.ContentType, item.Filename) {
+		limits := view.Limits()
+		maxSize := limits.MaxSize
+		if maxSize == 0 || h.renderMaxSize > 0 && h.renderMaxSize < maxSize {
+			maxSize = h.renderMaxSize
+		}
+		if limits.NoContent || limits.Streams || maxSize == 0 || item.Size <= maxSize {
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+// findView returns the named view, nil if it is not one of views
+func findView(views []render.Renderer, name string) render.Renderer {
+	for _, view := range views {
+		if view.Name() == name {
+			return view
+		}
+	}
+	return nil
+}
+
+// renderKey returns the cache key of an item's rendered page, empty if it
+// is not cached. Items stored before content hashes were recorded are not.
+func (h *Handler) renderKey(item *storage.Item, view render.Renderer, opts render.Options) string {
+	if h.cache == nil || item.SHA256 == "" {
+		return ""
+	}
+	variant, err := json.Marshal(opts)
+	if err != nil {
+		return ""
+	}
+	return cache.Key(item.ID, item.SHA256, render.Version(), view.Name(), item.ContentType, item.Filename, string(variant))
+}
+
+// cachePage keeps a rendered page in memory, and queues storing it if the
+// cache is persistent and stored is set
+func (h *Handler) cachePage(id string, key string, page []byte, stored bool) {
+	h.cache.Put(id, key, page)
+	if !stored || !h.cache.Persistent() {
+		return
+	}
+
+	h.jobs.Submit("cache "+id, func(ctx context.Context) error {
+		// The item may have been deleted since
+		if _, err := h.storage.GetMeta(ctx, id); err != nil {
+			return nil
+		}
+		return h.cache.Persist(ctx, id, key, page)
+	})
+}
+
+// serveArchiveMember serves a file from inside a zip or tar archive, rendered
+// like a top-level item unless ?raw=1 is given
+func (h *Handler) serveArchiveMember(w http.ResponseWriter, r *http.Request, id string, name string) {
+	ctx := r.Context()
+	item, err := h.storage.GetMeta(ctx, id)
+	if err != nil || !archive.IsArchive(item.ContentType, item.Filename) {
+		http.NotFound(w, r)
+		return
+	}
+	if h.archiveMaxSize > 0 && item.Size > h.archiveMaxSize {
+		http.Error(w, "Archive too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	content, err := h.openArchive(ctx, item)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+
+	member, err := archive.ReadFileAt(content, item.Size, name, h.renderOpts.ArchiveLimits)
+	switch {
+	case errors.Is(err, archive.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, archive.ErrTooLarge):
+		http.Error(w, "Archive member too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "Failed to read archive", http.StatusUnprocessableEntity)
+		return
+	}
+
+	filename := path.Base(name)
+	contentType := detectContentType(filename, member)
+
+	if r.URL.Query().Get("raw") == "" && render.CanRender(contentType) {
+		opts := h.renderOpts
+		opts.Table = render.ParseTableView(r.URL.Query())
+		opts.DiffSplit = r.URL.Query().Get("layout") == "split"
+		opts.FileURL = "/" + id + "/file/"
+		opts.Theme = h.pageTheme(r, item)
+
+		rawURL := (&url.URL{Path: "/" + id + "/file/" + name, RawQuery: "raw=1"}).String()
+		rendered, err := render.Render(contentType, member, filename, rawURL, opts)
+		if err == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Security-Policy", render.ContentSecurityPolicy(contentType, opts))
+			w.Write(rendered)
+			return
+		}
+	}
+
+	// Archive contents were never vetted as uploads, keep them from running
+	// script on this origin
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Security-Policy", sandboxCSP)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.Write(member)
+}
+
+// serveTableExport sends the rows of a CSV/TSV file selected by the sort and
+// filter query params as a CSV or JSON download
+func (h *Handler) serveTableExport(w http.ResponseWriter, r *http.Request, content io.Reader, item *storage.Item, format string) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		http.Error(w, "Failed to read content", http.StatusInternalServerError)
+		return
+	}
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		contentType = "application/json"
+	default:
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	exported, err := render.ExportTable(item.ContentType, data, render.ParseTableView(r.URL.Query()), format)
+	if err != nil {
+		http.Error(w, "Failed to parse table", http.StatusUnprocessableEntity)
+		return
+	}
+
+	name := strings.TrimSuffix(item.Filename, filepath.Ext(item.Filename))
+	if name == "" {
+		name = item.ID
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	w.Write(exported)
+}
+
+func (h *Handler) serveThumbnail(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	if _, err := h.storage.GetMeta(ctx, id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Thumbnails are generated in the background, so may not exist (yet)
+	thumb, err := h.storage.GetDerived(ctx, id, preview.ThumbnailName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer thumb.Close()
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	io.Copy(w, thumb)
+}
+
+// serveText serves the text extracted from a document for indexing
+func (h *Handler) serveText(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	if _, err := h.storage.GetMeta(ctx, id); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Extracted in the background like thumbnails
+	text, err := h.storage.GetDerived(ctx, id, textName)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer text.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.Copy(w, text)
+}
+
+// handleUpload stores a file sent as a multipart form or raw body with
+// POST /api/upload, or with PUT /api/upload/<filename> or PUT /<filename>
+// like curl -T sends it. Several files in one form, or a tar stream sent with
+// ?collection=true, are shared together as a collection.
 func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	// Check authentication
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.Header.Get("X-Share-Token")
-	}
-	token = strings.TrimPrefix(token, "Bearer ")
+	token := requestToken(r)
 
 	if !h.isValidToken(token) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -195,63 +665,246 @@ func (h *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
 		r.Body = http.MaxBytesReader(w, r.Body, h.maxFileSize)
 	}
 
+	// Settings shared by all files of the upload
+	now := time.Now().UTC()
+	base := &storage.Item{
+		CreatedAt:  now,
+		OwnerToken: token,
+	}
+	if err := setItemOptions(base, func(param string, header string) string {
+		return uploadOption(r, param, header)
+	}, now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Parse multipart form or read raw body
 	var content io.Reader
 	var filename string
 	var contentType string
 
 	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
-		file, header, err := r.FormFile("file")
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, "No file provided", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		files := r.MultipartForm.File["file"]
+		if len(files) == 0 {
+			http.Error(w, "No file provided", http.StatusBadRequest)
+			return
+		}
+		if len(files) > 1 {
+			h.storeCollection(w, r, base, multipartMembers(files))
+			return
+		}
+
+		file, err := files[0].Open()
 		if err != nil {
 			http.Error(w, "No file provided", http.StatusBadRequest)
 			return
 		}
 		defer file.Close()
 		content = file
-		filename = header.Filename
-		contentType = header.Header.Get("Content-Type")
+		filename = files[0].Filename
+		contentType = files[0].Header.Get("Content-Type")
 	} else {
+		if collection, _ := strconv.ParseBool(uploadOption(r, "collection", "X-Share-Collection")); collection {
+			h.storeCollection(w, r, base, tarMembers(r.Body))
+			return
+		}
+
 		content = r.Body
 		filename = r.URL.Query().Get("filename")
 		contentType = r.Header.Get("Content-Type")
+		if r.Method == http.MethodPut {
+			if name := path.Base(strings.TrimPrefix(r.URL.Path, "/api/upload")); name != "/" && name != "." {
+				filename = name
+			}
+		}
+	}
+
+	item := *base
+	item.ID = generateID()
+	item.Filename = filename
+	item.ContentType = contentType
+	if _, err := h.storeUpload(r, content, &item); err != nil {
+		uploadFailed(w, err)
+		return
+	}
+
+	h.itemStored(&item)
+
+	// Return URL
+	url := h.config.BaseURL + "/" + item.ID
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(url + "\n"))
+}
+
+// uploadError is an upload the uploader is told is wrong
+type uploadError struct {
+	code    int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+// uploadFailed answers an upload that could not be stored
+func uploadFailed(w http.ResponseWriter, err error) {
+	var uerr *uploadError
+	if errors.As(err, &uerr) {
+		http.Error(w, uerr.message, uerr.code)
+		return
+	}
+	log.Printf("Failed to store file: %v", err)
+	http.Error(w, "Failed to store file", http.StatusInternalServerError)
+}
+
+// storeUpload stores content as item, detecting its type if not declared and
+// removing image metadata if asked to. It returns the first bytes of the
+// content, which its type was detected from.
+func (h *Handler) storeUpload(r *http.Request, content io.Reader, item *storage.Item) ([]byte, error) {
+	content, head, err := h.prepareUpload(r, content, item)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.storage.Put(r.Context(), item.ID, content, item); err != nil {
+		return nil, err
+	}
+	return head, nil
+}
+
+// prepareUpload detects the type of content to be stored as item if not
+// declared and removes image metadata if asked to. It returns the content to
+// store and its first bytes.
+func (h *Handler) prepareUpload(r *http.Request, content io.Reader, item *storage.Item) (io.Reader, []byte, error) {
+	// Look at the first bytes to recognize the format, without consuming them
+	peek := bufio.NewReaderSize(content, sniffLen)
+	// Short uploads are peeked whole, read errors surface when storing
+	head, _ := peek.Peek(sniffLen)
+	head = bytes.Clone(head)
+	content = peek
+
+	if isCollectionType(item.ContentType) {
+		return nil, nil, &uploadError{http.StatusBadRequest, "Invalid content type"}
+	}
+	item.ContentType = uploadContentType(item.ContentType, item.Filename, head)
+
+	// Strip EXIF/GPS metadata from photos if requested or enabled by default
+	if h.shouldStripMetadata(r) && imaging.CanStrip(item.ContentType) {
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return nil, nil, &uploadError{http.StatusBadRequest, "Failed to read upload"}
+		}
+		stripped, err := imaging.StripMetadata(item.ContentType, data)
+		if err != nil {
+			return nil, nil, &uploadError{http.StatusUnprocessableEntity, "Failed to strip image metadata"}
+		}
+		content = bytes.NewReader(stripped)
 	}
+	return content, head, nil
+}
 
-	// Detect content type if not provided
-	if contentType == "" || contentType == "application/octet-stream" {
-		contentType = detectContentType(filename, nil)
+// itemStored queues background work for a newly stored item, and drops
+// pages rendered from content it replaced
+func (h *Handler) itemStored(item *storage.Item) {
+	if h.cache != nil {
+		h.cache.Invalidate(item.ID)
+		if err := h.cache.Drop(context.Background(), item.ID); err != nil {
+			log.Printf("Failed to drop cached page of %s: %v", item.ID, err)
+		}
 	}
+	h.schedulePreview(item)
+	h.scheduleTextExtraction(item)
+}
 
-	// Get render mode from query param
-	renderMode := r.URL.Query().Get("render")
-	if renderMode == "" {
-		renderMode = "auto"
+// itemReplaced removes the artifacts derived from content an item no longer
+// has before queueing them again for the new one, so its thumbnail and text
+// never show what was replaced
+func (h *Handler) itemReplaced(ctx context.Context, item *storage.Item) {
+	for _, name := range []string{preview.ThumbnailName, textName} {
+		if err := h.storage.DeleteDerived(ctx, item.ID, name); err != nil {
+			log.Printf("Failed to delete %s of %s: %v", name, item.ID, err)
+		}
 	}
+	h.itemStored(item)
+}
 
-	// Generate ID
-	id := generateID()
+// itemDeleted drops the cached pages and site listing of a deleted item
+func (h *Handler) itemDeleted(id string) {
+	if h.cache != nil {
+		h.cache.Invalidate(id)
+	}
+	h.sitesMu.Lock()
+	delete(h.sites, id)
+	h.sitesMu.Unlock()
+}
 
-	// Create item
-	item := &storage.Item{
-		ID:          id,
-		Filename:    filename,
-		ContentType: contentType,
-		RenderMode:  renderMode,
-		CreatedAt:   time.Now().UTC(),
-		OwnerToken:  token,
+// schedulePreview queues thumbnail generation for a newly stored item
+func (h *Handler) schedulePreview(item *storage.Item) {
+	if h.previews == nil || !h.previews.CanGenerate(item.ContentType) {
+		return
 	}
 
-	// Store
-	if err := h.storage.Put(r.Context(), id, content, item); err != nil {
-		log.Printf("Failed to store file: %v", err)
-		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+	id := item.ID
+	h.jobs.Submit("thumbnail "+id, func(ctx context.Context) error {
+		return h.previews.Generate(ctx, id)
+	})
+}
+
+// scheduleTextExtraction queues extracting the text of a document so it can
+// be searched
+func (h *Handler) scheduleTextExtraction(item *storage.Item) {
+	if !render.IsPDF(item.ContentType, item.Filename) || item.Size > maxTextSource {
 		return
 	}
 
-	// Return URL
-	url := h.config.BaseURL + "/" + id
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusCreated)
-	w.Write([]byte(url + "\n"))
+	id := item.ID
+	h.jobs.Submit("text "+id, func(ctx context.Context) error {
+		content, _, err := h.storage.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(content)
+		content.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+
+		text, err := render.ExtractPDFText(data)
+		if err != nil {
+			return err
+		}
+		return h.storage.PutDerived(ctx, id, textName, strings.NewReader(text))
+	})
+}
+
+// pageTheme returns the color theme of a rendered view: the viewer's choice
+// with ?theme=, else the one set at upload, else the server default
+func (h *Handler) pageTheme(r *http.Request, item *storage.Item) string {
+	if theme := r.URL.Query().Get("theme"); render.ValidTheme(theme) {
+		return theme
+	}
+	if render.ValidTheme(item.Theme) {
+		return item.Theme
+	}
+	return h.renderOpts.Theme
+}
+
+// shouldStripMetadata reports whether image metadata should be removed from an
+// upload, using the strip_metadata query param or the server default
+func (h *Handler) shouldStripMetadata(r *http.Request) bool {
+	if v := r.URL.Query().Get("strip_metadata"); v != "" {
+		strip, err := strconv.ParseBool(v)
+		if err == nil {
+			return strip
+		}
+	}
+	return h.config.Uploads.StripMetadata
 }
 
 func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
@@ -260,11 +913,7 @@ func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.Header.Get("X-Share-Token")
-	}
-	token = strings.TrimPrefix(token, "Bearer ")
+	token := requestToken(r)
 
 	if !h.isValidToken(token) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -285,17 +934,28 @@ func (h *Handler) handleList(w http.ResponseWriter, r *http.Request) {
 		Filename string `json:"filename"`
 		Size     int64  `json:"size"`
 		Created  string `json:"created"`
+		Expires  string `json:"expires,omitempty"`
+		MaxViews int    `json:"max_views,omitempty"`
 	}
 
-	response := make([]listItem, len(items))
-	for i, item := range items {
-		response[i] = listItem{
+	// Files of a collection are listed as the collection
+	response := make([]listItem, 0, len(items))
+	for _, item := range items {
+		if item.Collection != "" {
+			continue
+		}
+		entry := listItem{
 			ID:       item.ID,
 			URL:      h.config.BaseURL + "/" + item.ID,
 			Filename: item.Filename,
 			Size:     item.Size,
 			Created:  item.CreatedAt.Format(time.RFC3339),
+			MaxViews: item.MaxViews,
+		}
+		if item.ExpiresAt != nil {
+			entry.Expires = item.ExpiresAt.Format(time.RFC3339)
 		}
+		response = append(response, entry)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -310,11 +970,7 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := r.Header.Get("Authorization")
-	if token == "" {
-		token = r.Header.Get("X-Share-Token")
-	}
-	token = strings.TrimPrefix(token, "Bearer ")
+	token := requestToken(r)
 
 	if !h.isValidToken(token) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -340,7 +996,7 @@ func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.storage.Delete(r.Context(), id); err != nil {
+	if err := h.deleteItem(r.Context(), item); err != nil {
 		log.Printf("Failed to delete item: %v", err)
 		http.Error(w, "Failed to delete", http.StatusInternalServerError)
 		return
@@ -354,6 +1010,55 @@ func (h *Handler) handleRobots(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User-agent: *\nDisallow: /\n"))
 }
 
+func (h *Handler) handleAsset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse path: /_assets/<version>/<name>
+	version, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, render.AssetPrefix), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	asset, found := render.LookupAsset(name)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Only the current version may be cached forever, a stale version
+	// (e.g. from a page rendered before an upgrade) gets the current content
+	if version == asset.Version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("ETag", `"`+asset.Version+`"`)
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(asset.Data))
+}
+
+// requestToken returns the API token of a request: a Bearer token, the
+// X-Share-Token header, or Basic auth as curl -u sends it, where the token is
+// the password or, without one, the username
+func requestToken(r *http.Request) string {
+	if user, password, ok := r.BasicAuth(); ok {
+		if password != "" {
+			return password
+		}
+		return user
+	}
+	token := r.Header.Get("Authorization")
+	if token == "" {
+		token = r.Header.Get("X-Share-Token")
+	}
+	return strings.TrimPrefix(token, "Bearer ")
+}
+
 func (h *Handler) isValidToken(token string) bool {
 	if token == "" {
 		return false
@@ -373,8 +1078,40 @@ func generateID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// uploadContentType returns the type of an upload from the one declared by
+// the client, detecting it if not provided. Raw bodies sent by curl without a
+// type are declared as form data.
+func uploadContentType(declared string, filename string, head []byte) string {
+	switch {
+	case declared == "" || declared == "application/octet-stream" || declared == "application/x-www-form-urlencoded":
+		return detectContentType(filename, head)
+	case render.IsText(declared) && render.IsBinary(head):
+		// e.g. binary data piped to a client that declares stdin as text
+		return sniffContentType(head)
+	}
+	return declared
+}
+
+// isCollectionType reports whether contentType is the type of collections,
+// which only the server gives the items it builds
+func isCollectionType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == render.CollectionType
+}
+
+// detectContentType determines the type of content from its filename, and
+// from its first bytes when the extension is unknown. Binary content is never
+// given a text type, so it is not rendered as text whatever its name.
 func detectContentType(filename string, content []byte) string {
-	// Try by extension first
+	if ct := typeByExtension(filename); ct != "" && !isCollectionType(ct) && !(render.IsText(ct) && render.IsBinary(content)) {
+		return ct
+	}
+	return sniffContentType(content)
+}
+
+// typeByExtension returns the type of a file by its extension, empty if the
+// extension is unknown
+func typeByExtension(filename string) string {
 	if filename != "" {
 		ext := filepath.Ext(filename)
 		if mimeType := mime.TypeByExtension(ext); mimeType != "" {
@@ -385,6 +1122,24 @@ func detectContentType(filename string, content []byte) string {
 		switch strings.ToLower(ext) {
 		case ".md", ".markdown":
 			return "text/markdown"
+		case ".csv":
+			return "text/csv"
+		case ".tsv", ".tab":
+			return "text/tab-separated-values"
+		case ".ipynb":
+			return "application/x-ipynb+json"
+		case ".diff", ".patch":
+			return "text/x-diff"
+		case ".zip":
+			return "application/zip"
+		case ".tar":
+			return "application/x-tar"
+		case ".tgz":
+			return "application/gzip"
+		case ".cast":
+			return "application/x-asciicast"
+		case ".log":
+			return "text/plain"
 		case ".ts":
 			return "text/typescript"
 		case ".tsx":
@@ -412,12 +1167,7 @@ func detectContentType(filename string, content []byte) string {
 		}
 	}
 
-	// Try detecting from content
-	if len(content) > 0 {
-		return http.DetectContentType(content)
-	}
-
-	return "text/plain"
+	return ""
 }
 
 func formatSize(size int64) string {
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// rangeBlockSize is how much of an archive is fetched at once when it is read
+// in place with ranged reads, so zip directories are not read a few bytes at
+// a time
+const rangeBlockSize = 256 << 10
+
+// maxSites is how many static sites' listings are kept in memory
+const maxSites = 256
+
+// siteIndex is the listing of a static site uploaded as an archive
+type siteIndex struct {
+	sha256 string          // content the listing was read from
+	root   string          // directory holding index.html, empty if the archive is no site
+	files  map[string]bool // regular files by cleaned path
+}
+
+// siteIndex returns the listing of an archive hosted as a static site, read
+// once per content of the item
+func (h *Handler) siteIndex(ctx context.Context, item *storage.Item) (*siteIndex, error) {
+	h.sitesMu.Lock()
+	site := h.sites[item.ID]
+	h.sitesMu.Unlock()
+	if site != nil && item.SHA256 != "" && site.sha256 == item.SHA256 {
+		return site, nil
+	}
+
+	content, err := h.openArchive(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	listing, err := archive.ListAt(content, item.Size, h.renderOpts.ArchiveLimits)
+	if err != nil {
+		return nil, err
+	}
+	site = &siteIndex{sha256: item.SHA256, files: make(map[string]bool)}
+	for _, e := range listing.Entries {
+		if !e.Dir {
+			site.files[e.Path] = true
+		}
+	}
+	if root, ok := archive.SiteRoot(listing); ok {
+		site.root = root
+	}
+
+	// Items stored before content hashes were recorded are read every time
+	if item.SHA256 != "" {
+		h.sitesMu.Lock()
+		if len(h.sites) >= maxSites {
+			for id := range h.sites {
+				delete(h.sites, id)
+				break
+			}
+		}
+		h.sites[item.ID] = site
+		h.sitesMu.Unlock()
+	}
+	return site, nil
+}
+
+// archiveContent is an archive opened for reading its members
+type archiveContent interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// openArchive opens an item's content for random access: files as they are,
+// objects with ranged reads if the backend supports them, anything else read
+// into memory. Callers check the item's size against archiveMaxSize first.
+func (h *Handler) openArchive(ctx context.Context, item *storage.Item) (archiveContent, error) {
+	if ranges, ok := h.storage.(storage.RangeStore); ok {
+		return &rangeReader{ctx: ctx, store: ranges, id: item.ID, size: item.Size}, nil
+	}
+
+	content, _, err := h.storage.Get(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	if ra, ok := content.(archiveContent); ok {
+		return ra, nil
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+// rangeReader reads an item's content with ranged reads from storage,
+// keeping the last block fetched. It is not safe for concurrent use.
+type rangeReader struct {
+	ctx   context.Context
+	store storage.RangeStore
+	id    string
+	size  int64
+
+	block    []byte
+	blockOff int64
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		if pos < r.blockOff || pos >= r.blockOff+int64(len(r.block)) {
+			if err := r.fetch(pos, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		n += copy(p[n:], r.block[pos-r.blockOff:])
+	}
+	return n, nil
+}
+
+// fetch reads the block starting at off, at least length bytes long unless
+// the content ends first
+func (r *rangeReader) fetch(off int64, length int64) error {
+	length = min(max(length, rangeBlockSize), r.size-off)
+	content, err := r.store.GetRange(r.ctx, r.id, off, length)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	block := make([]byte, length)
+	if _, err := io.ReadFull(content, block); err != nil {
+		return err
+	}
+	r.block, r.blockOff = block, off
+	return nil
+}
+
+func (r *rangeReader) Close() error {
+	return nil
+}
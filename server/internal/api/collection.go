@@ -0,0 +1,286 @@
+package api
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/render"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// excerptLines is how many lines of text members the collection page shows
+const excerptLines = 8
+
+// memberSource calls add with each file of a collection upload, in order,
+// stopping at the first error
+type memberSource func(add func(name string, contentType string, content io.Reader) error) error
+
+// multipartMembers returns the files of a multipart form
+func multipartMembers(files []*multipart.FileHeader) memberSource {
+	return func(add func(string, string, io.Reader) error) error {
+		for _, fh := range files {
+			file, err := fh.Open()
+			if err != nil {
+				return &uploadError{http.StatusBadRequest, "Failed to read upload"}
+			}
+			err = add(fh.Filename, fh.Header.Get("Content-Type"), file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// tarMembers returns the regular files of a plain or gzip-compressed tar
+// stream, as tar cz writes it
+func tarMembers(body io.Reader) memberSource {
+	return func(add func(string, string, io.Reader) error) error {
+		br := bufio.NewReader(body)
+		var r io.Reader = br
+		if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				return &uploadError{http.StatusBadRequest, "Invalid tar stream"}
+			}
+			defer gz.Close()
+			r = gz
+		}
+
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					return &uploadError{http.StatusRequestEntityTooLarge, "Upload too large"}
+				}
+				return &uploadError{http.StatusBadRequest, "Invalid tar stream"}
+			}
+			// Directories are implied by member paths, links are not followed
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			if err := add(header.Name, "", tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// storeCollection stores each file of an upload as an item of its own, and
+// a collection item listing them. Files stored before one fails are removed.
+func (h *Handler) storeCollection(w http.ResponseWriter, r *http.Request, base *storage.Item, members memberSource) {
+	ctx := r.Context()
+	collection := *base
+	collection.ID = generateID()
+	collection.Filename = uploadOption(r, "title", "X-Share-Title")
+	collection.ContentType = render.CollectionType
+	// The page lists the files, its raw form is the zip of all of them
+	collection.RenderMode = "auto"
+
+	var manifest render.Collection
+	var stored []*storage.Item
+	err := members(func(name string, contentType string, content io.Reader) error {
+		name, ok := archive.CleanPath(name)
+		if !ok {
+			return &uploadError{http.StatusBadRequest, "Invalid file name"}
+		}
+
+		item := *base
+		item.ID = generateID()
+		item.Filename = path.Base(name)
+		item.ContentType = contentType
+		item.Collection = collection.ID
+		// Views are counted on the collection, admit holds its files to its limits
+		item.MaxViews = 0
+
+		head, err := h.storeUpload(r, content, &item)
+		if err != nil {
+			return err
+		}
+		stored = append(stored, &item)
+		manifest.Members = append(manifest.Members, h.collectionMember(&item, name, head))
+		return nil
+	})
+	if err == nil && len(stored) == 0 {
+		err = &uploadError{http.StatusBadRequest, "No file provided"}
+	}
+
+	var data []byte
+	if err == nil {
+		if data, err = json.Marshal(manifest); err == nil {
+			err = h.storage.Put(ctx, collection.ID, bytes.NewReader(data), &collection)
+		}
+	}
+	if err != nil {
+		for _, item := range stored {
+			h.storage.Delete(ctx, item.ID)
+		}
+		uploadFailed(w, err)
+		return
+	}
+
+	for _, item := range stored {
+		h.itemStored(item)
+	}
+	h.itemStored(&collection)
+
+	url := h.config.BaseURL + "/" + collection.ID
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(url + "\n"))
+}
+
+// collectionMember describes a stored file on the collection page: images
+// by their thumbnail, or themselves if thumbnails are disabled, text by its
+// first lines
+func (h *Handler) collectionMember(item *storage.Item, name string, head []byte) render.CollectionMember {
+	m := render.CollectionMember{
+		ID:          item.ID,
+		Name:        name,
+		ContentType: item.ContentType,
+		Size:        item.Size,
+	}
+
+	switch {
+	case h.previews != nil && h.previews.CanGenerate(item.ContentType):
+		m.Preview = "/" + item.ID + "/thumb"
+	case strings.HasPrefix(item.ContentType, "image/"):
+		m.Preview = "/" + item.ID + "/raw"
+	case render.IsText(item.ContentType) && !render.IsBinary(head):
+		lines := strings.SplitN(string(head), "\n", excerptLines+1)
+		m.Excerpt = strings.ToValidUTF8(strings.Join(lines[:min(len(lines), excerptLines)], "\n"), "")
+	}
+	return m
+}
+
+// collectionOf returns the members listed by a collection item
+func (h *Handler) collectionOf(ctx context.Context, id string) (*render.Collection, error) {
+	content, _, err := h.storage.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	return render.ParseCollection(data)
+}
+
+// serveCollectionZip streams the files of a collection as a zip archive,
+// built as it is sent. Files removed from the collection since are left out.
+func (h *Handler) serveCollectionZip(w http.ResponseWriter, r *http.Request, item *storage.Item) {
+	ctx := r.Context()
+	collection, err := h.collectionOf(ctx, item.ID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := item.Filename
+	if name == "" {
+		name = item.ID
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	zw := zip.NewWriter(w)
+	names := map[string]bool{}
+	for _, m := range collection.Members {
+		content, member, err := h.storage.Get(ctx, m.ID)
+		if err != nil {
+			continue
+		}
+		if !inCollection(member, item) {
+			content.Close()
+			continue
+		}
+
+		header := &zip.FileHeader{
+			Name:     uniqueName(names, m.Name),
+			Method:   zip.Deflate,
+			Modified: member.CreatedAt,
+		}
+		if f, err := zw.CreateHeader(header); err == nil {
+			_, err = io.Copy(f, content)
+		}
+		content.Close()
+		if err != nil {
+			// The response has started, so the archive is cut short
+			log.Printf("Failed to write zip of %s: %v", item.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to write zip of %s: %v", item.ID, err)
+	}
+}
+
+// inCollection reports whether member was shared in collection. Manifests
+// are stored as uploaded, so a file they list is only taken as a member if
+// its own metadata says so.
+func inCollection(member *storage.Item, collection *storage.Item) bool {
+	return member.Collection == collection.ID && member.OwnerToken == collection.OwnerToken
+}
+
+// uniqueName returns name, numbered if it is already taken, and takes it
+func uniqueName(taken map[string]bool, name string) string {
+	unique := name
+	ext := path.Ext(name)
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// deleteItem removes an item, and the files shared with it if it is a
+// collection
+func (h *Handler) deleteItem(ctx context.Context, item *storage.Item) error {
+	if item.ContentType == render.CollectionType {
+		if collection, err := h.collectionOf(ctx, item.ID); err == nil {
+			for _, m := range collection.Members {
+				member, err := h.storage.GetMeta(ctx, m.ID)
+				if err != nil || !inCollection(member, item) {
+					continue
+				}
+				if err := h.storage.Delete(ctx, m.ID); err != nil {
+					log.Printf("Failed to delete %s of collection %s: %v", m.ID, item.ID, err)
+					continue
+				}
+				h.itemDeleted(m.ID)
+			}
+		}
+	}
+
+	if err := h.storage.Delete(ctx, item.ID); err != nil {
+		return err
+	}
+	h.itemDeleted(item.ID)
+	return nil
+}
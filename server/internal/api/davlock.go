@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fileri/share/server/internal/config"
+	"github.com/Fileri/share/server/internal/storage"
+	"golang.org/x/net/webdav"
+)
+
+// lockCleanupInterval is how often expired locks are removed from storage
+const lockCleanupInterval = time.Minute
+
+// lockListTTL is how long the stored locks are reused for checking writes
+// against, so that each write does not list the locks in storage
+const lockListTTL = 5 * time.Second
+
+// newLockSystem creates the WebDAV lock system selected in the configuration
+func newLockSystem(cfg config.WebDAVConfig, store storage.Storage) webdav.LockSystem {
+	if cfg.LockSystem != "storage" {
+		return webdav.NewMemLS()
+	}
+
+	lockStore, ok := store.(storage.LockStore)
+	if !ok {
+		log.Printf("Storage backend does not support persistent locks, using in-memory locks")
+		return webdav.NewMemLS()
+	}
+
+	timeout, err := time.ParseDuration(cfg.LockTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = 24 * time.Hour
+	}
+
+	ls := &storageLockSystem{
+		store:      lockStore,
+		maxTimeout: timeout,
+		held:       make(map[string]bool),
+		temporary:  make(map[string]*storage.Lock),
+	}
+	go ls.cleanupLoop()
+	return ls
+}
+
+// storageLockSystem implements webdav.LockSystem on top of a storage.LockStore,
+// so locks survive restarts and are shared between instances.
+type storageLockSystem struct {
+	store      storage.LockStore
+	maxTimeout time.Duration // expiry used for locks requested with an infinite timeout
+
+	mu        sync.Mutex
+	held      map[string]bool          // lock tokens held by in-flight requests on this instance
+	temporary map[string]*storage.Lock // locks of single requests on this instance, by token
+	listed    []*storage.Lock          // stored locks as last listed
+	listedAt  time.Time                // when listed was read, zero to list again
+}
+
+// isTemporary reports whether a lock is the one x/net/webdav takes for the
+// duration of a write without an If header: no owner, zero depth and an
+// infinite timeout. Such locks are kept in memory, so a crash mid-request
+// does not leave the resource locked.
+func isTemporary(details webdav.LockDetails) bool {
+	return details.Duration < 0 && details.ZeroDepth && details.OwnerXML == ""
+}
+
+// activeLocks returns all unexpired stored locks, removing expired ones on
+// the way. Locks listed less than maxAge ago are reused.
+func (s *storageLockSystem) activeLocks(ctx context.Context, now time.Time, maxAge time.Duration) ([]*storage.Lock, error) {
+	s.mu.Lock()
+	locks, listedAt := s.listed, s.listedAt
+	s.mu.Unlock()
+
+	if listedAt.IsZero() || now.Sub(listedAt) >= maxAge {
+		var err error
+		if locks, err = s.store.ListLocks(ctx); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.listed, s.listedAt = locks, now
+		s.mu.Unlock()
+	}
+
+	var active []*storage.Lock
+	for _, lock := range locks {
+		if lock.Expired(now) {
+			if err := s.store.DeleteLock(ctx, lock); err != nil {
+				log.Printf("Failed to delete expired lock on %s: %v", lock.Root, err)
+			}
+			continue
+		}
+		active = append(active, lock)
+	}
+	return active, nil
+}
+
+// stored drops the listed locks after this instance changed them
+func (s *storageLockSystem) stored() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listedAt = time.Time{}
+}
+
+// findLock returns the unexpired stored lock with the given token, listing
+// the locks again if it is not among those last listed
+func (s *storageLockSystem) findLock(ctx context.Context, now time.Time, token string) (*storage.Lock, error) {
+	for _, maxAge := range []time.Duration{lockListTTL, 0} {
+		locks, err := s.activeLocks(ctx, now, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		for _, lock := range locks {
+			if lock.Token == token {
+				return lock, nil
+			}
+		}
+	}
+	return nil, webdav.ErrNoSuchLock
+}
+
+func (s *storageLockSystem) cleanupLoop() {
+	ticker := time.NewTicker(lockCleanupInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		for token, lock := range s.temporary {
+			if lock.Expired(now) {
+				delete(s.temporary, token)
+			}
+		}
+		s.mu.Unlock()
+
+		if _, err := s.activeLocks(context.Background(), now, 0); err != nil {
+			log.Printf("Failed to clean up expired locks: %v", err)
+		}
+	}
+}
+
+func (s *storageLockSystem) expiry(now time.Time, duration time.Duration) time.Time {
+	if duration < 0 || duration > s.maxTimeout {
+		duration = s.maxTimeout
+	}
+	return now.Add(duration)
+}
+
+// Confirm checks that the conditions match locks covering the named resources
+// and holds those locks until the returned release function is called.
+func (s *storageLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	// Locks taken on other instances since the last listing are looked up
+	// in storage
+	for _, maxAge := range []time.Duration{lockListTTL, 0} {
+		locks, err := s.activeLocks(context.Background(), now, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		if release, ok := s.confirm(locks, name0, name1, conditions); ok {
+			return release, nil
+		}
+	}
+	return nil, webdav.ErrConfirmationFailed
+}
+
+// confirm holds the locks matching the conditions for both names, if there
+// are any
+func (s *storageLockSystem) confirm(locks []*storage.Lock, name0, name1 string, conditions []webdav.Condition) (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tokens []string
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		lock := s.lookup(locks, slashClean(name), conditions)
+		if lock == nil {
+			return nil, false
+		}
+		if len(tokens) == 0 || tokens[0] != lock.Token {
+			tokens = append(tokens, lock.Token)
+		}
+	}
+
+	for _, token := range tokens {
+		s.held[token] = true
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, token := range tokens {
+			delete(s.held, token)
+		}
+	}, true
+}
+
+// lookup returns a lock that matches one of the conditions and covers name.
+// Callers must hold s.mu.
+func (s *storageLockSystem) lookup(locks []*storage.Lock, name string, conditions []webdav.Condition) *storage.Lock {
+	for _, c := range conditions {
+		for _, lock := range locks {
+			if lock.Token != c.Token || s.held[lock.Token] {
+				continue
+			}
+			if name == lock.Root || (!lock.ZeroDepth && isDescendant(name, lock.Root)) {
+				return lock
+			}
+		}
+	}
+	return nil
+}
+
+// Create creates a lock unless it conflicts with an existing one. Temporary
+// locks are checked against the stored locks as last listed.
+func (s *storageLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	ctx := context.Background()
+	root := slashClean(details.Root)
+	temporary := isTemporary(details)
+
+	maxAge := time.Duration(0)
+	if temporary {
+		maxAge = lockListTTL
+	}
+	locks, err := s.activeLocks(ctx, now, maxAge)
+	if err != nil {
+		return "", err
+	}
+
+	lock := &storage.Lock{
+		Token:     generateLockToken(),
+		Root:      root,
+		ZeroDepth: details.ZeroDepth,
+		OwnerXML:  details.OwnerXML,
+		Duration:  details.Duration,
+		ExpiresAt: s.expiry(now, details.Duration),
+	}
+
+	s.mu.Lock()
+	for _, held := range s.temporary {
+		if !held.Expired(now) {
+			locks = append(locks, held)
+		}
+	}
+	for _, other := range locks {
+		if conflicts(lock, other) {
+			s.mu.Unlock()
+			return "", webdav.ErrLocked
+		}
+	}
+	if temporary {
+		s.temporary[lock.Token] = lock
+		s.mu.Unlock()
+		return lock.Token, nil
+	}
+	s.mu.Unlock()
+
+	if err := s.store.CreateLock(ctx, lock); err != nil {
+		if errors.Is(err, storage.ErrLockExists) {
+			return "", webdav.ErrLocked
+		}
+		return "", err
+	}
+	s.stored()
+
+	return lock.Token, nil
+}
+
+// conflicts reports whether two locks cover the same resource
+func conflicts(a, b *storage.Lock) bool {
+	return a.Root == b.Root ||
+		(!a.ZeroDepth && isDescendant(b.Root, a.Root)) ||
+		(!b.ZeroDepth && isDescendant(a.Root, b.Root))
+}
+
+// Refresh extends the expiry of an existing lock
+func (s *storageLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ctx := context.Background()
+
+	lock, err := s.findLock(ctx, now, token)
+	if err != nil {
+		return webdav.LockDetails{}, err
+	}
+	if s.isHeld(token) {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+
+	lock.Duration = duration
+	lock.ExpiresAt = s.expiry(now, duration)
+	if err := s.store.UpdateLock(ctx, lock); err != nil {
+		return webdav.LockDetails{}, err
+	}
+	s.stored()
+
+	return webdav.LockDetails{
+		Root:      lock.Root,
+		Duration:  lock.Duration,
+		OwnerXML:  lock.OwnerXML,
+		ZeroDepth: lock.ZeroDepth,
+	}, nil
+}
+
+// Unlock removes an existing lock
+func (s *storageLockSystem) Unlock(now time.Time, token string) error {
+	ctx := context.Background()
+
+	s.mu.Lock()
+	if _, ok := s.temporary[token]; ok {
+		delete(s.temporary, token)
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	lock, err := s.findLock(ctx, now, token)
+	if err != nil {
+		return err
+	}
+	if s.isHeld(token) {
+		return webdav.ErrLocked
+	}
+
+	if err := s.store.DeleteLock(ctx, lock); err != nil {
+		return err
+	}
+	s.stored()
+	return nil
+}
+
+func (s *storageLockSystem) isHeld(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.held[token]
+}
+
+// isDescendant reports whether name lies strictly below root
+func isDescendant(name, root string) bool {
+	if root == "/" {
+		return name != "/"
+	}
+	return strings.HasPrefix(name, root+"/")
+}
+
+// slashClean normalizes a lock path the same way webdav.NewMemLS does
+func slashClean(name string) string {
+	if name == "" || name[0] != '/' {
+		name = "/" + name
+	}
+	return path.Clean(name)
+}
+
+func generateLockToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
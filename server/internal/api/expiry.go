@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fileri/share/server/internal/render"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// viewGrace is how long the images, players and thumbnails of a page stay
+// available after the last view a share allows
+const viewGrace = 5 * time.Minute
+
+// viewCountName is the derived artifact counting the views of an item with a
+// view limit, so views do not rewrite item metadata
+const viewCountName = "views.json"
+
+type viewCount struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// uploadOption returns an upload setting from its query param, or from its
+// header for clients like curl where headers are easier to set
+func uploadOption(r *http.Request, param string, header string) string {
+	if v := r.URL.Query().Get(param); v != "" {
+		return v
+	}
+	return strings.TrimSpace(r.Header.Get(header))
+}
+
+// setItemOptions applies the upload settings returned by option, which looks
+// a setting up by its query param and header name. Errors are meant for the
+// uploader.
+func setItemOptions(item *storage.Item, option func(param string, header string) string, now time.Time) error {
+	// Render mode
+	item.RenderMode = option("render", "X-Share-Render")
+	switch item.RenderMode {
+	case "":
+		item.RenderMode = "auto"
+	case "auto", "raw", "render":
+	default:
+		return errors.New("Invalid render mode")
+	}
+
+	// Expiry as a duration like "24h" or "7d", or a time
+	expiresAt, err := parseExpiry(option("expires", "X-Share-Expires"), now)
+	if err != nil {
+		return errors.New("Invalid expiry")
+	}
+	item.ExpiresAt = expiresAt
+
+	// Times the share can be opened before it is gone
+	if v := option("max_views", "X-Share-Max-Views"); v != "" {
+		if item.MaxViews, err = strconv.Atoi(v); err != nil || item.MaxViews < 0 {
+			return errors.New("Invalid max views")
+		}
+	}
+
+	// Color theme of the rendered view, the server default if not given
+	item.Theme = option("theme", "X-Share-Theme")
+	if item.Theme != "" && !render.ValidTheme(item.Theme) {
+		return errors.New("Invalid theme")
+	}
+
+	// Leave out OpenGraph tags and oEmbed, so chat apps show a bare link
+	item.NoPreview, _ = strconv.ParseBool(option("no_preview", "X-Share-No-Preview"))
+	return nil
+}
+
+// parseExpiry parses when an upload expires: a duration from now like "90m",
+// "24h" or "7d", or an RFC 3339 time. Empty means it does not expire.
+func parseExpiry(s string, now time.Time) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var expiresAt time.Time
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, err
+		}
+		expiresAt = now.AddDate(0, 0, n)
+	} else if d, err := time.ParseDuration(s); err == nil {
+		expiresAt = now.Add(d)
+	} else if expiresAt, err = time.Parse(time.RFC3339, s); err != nil {
+		return nil, err
+	}
+
+	if !expiresAt.After(now) {
+		return nil, errors.New("expiry is in the past")
+	}
+	expiresAt = expiresAt.UTC()
+	return &expiresAt, nil
+}
+
+// admit reports whether a share can be served, answering 404 if it has
+// expired or run out of views. Opening the share counts as a view, the
+// images and players its page loads, thumbnails and HEAD requests do not.
+// Protected shares are answered with 401 until the password is given.
+func (h *Handler) admit(w http.ResponseWriter, r *http.Request, id string, opened bool) bool {
+	ctx := r.Context()
+	item, err := h.storage.GetMeta(ctx, id)
+	if err != nil {
+		// Missing items are answered by the handlers
+		return true
+	}
+
+	// Files of a collection share its expiry and view limit. Opening them is
+	// not a view of their own, they are gone after the collection's last one.
+	if item.Collection != "" {
+		collection, err := h.storage.GetMeta(ctx, item.Collection)
+		if err != nil {
+			http.NotFound(w, r)
+			return false
+		}
+		// Only viewers with the password are asked for it
+		if !h.unlocked(ctx, r, item) {
+			askPassword(w)
+			return false
+		}
+		item, opened = collection, false
+	}
+
+	now := time.Now()
+	if item.Expired(now) {
+		h.expire(item.ID)
+		http.NotFound(w, r)
+		return false
+	}
+	// Only viewers with the password are asked for it, before a view counts
+	if !h.unlocked(ctx, r, item) {
+		askPassword(w)
+		return false
+	}
+	if item.MaxViews == 0 {
+		return true
+	}
+
+	dest := r.Header.Get("Sec-Fetch-Dest")
+	counted := opened && r.Method == http.MethodGet && (dest == "" || dest == "document")
+
+	h.viewsMu.Lock()
+	defer h.viewsMu.Unlock()
+
+	views := h.viewCount(ctx, item.ID)
+	if views.Count >= item.MaxViews {
+		if now.Sub(views.Last) > viewGrace {
+			h.expire(item.ID)
+		} else if !counted {
+			return true
+		}
+		http.NotFound(w, r)
+		return false
+	}
+
+	if counted {
+		views.Count++
+		views.Last = now
+		if err := h.putViewCount(ctx, item.ID, views); err != nil {
+			log.Printf("Failed to count view of %s: %v", item.ID, err)
+		}
+	}
+	return true
+}
+
+// askPassword answers a request for a protected share, which browsers show
+// as a password prompt
+func askPassword(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Protected share", charset="UTF-8"`)
+	http.Error(w, "Password required", http.StatusUnauthorized)
+}
+
+// viewCount returns how often an item was opened, none if it never was
+func (h *Handler) viewCount(ctx context.Context, id string) viewCount {
+	var views viewCount
+	derived, err := h.storage.GetDerived(ctx, id, viewCountName)
+	if err != nil {
+		return views
+	}
+	defer derived.Close()
+
+	if err := json.NewDecoder(derived).Decode(&views); err != nil {
+		log.Printf("Failed to read view count of %s: %v", id, err)
+	}
+	return views
+}
+
+func (h *Handler) putViewCount(ctx context.Context, id string, views viewCount) error {
+	data, err := json.Marshal(views)
+	if err != nil {
+		return err
+	}
+	return h.storage.PutDerived(ctx, id, viewCountName, bytes.NewReader(data))
+}
+
+// expire deletes an item that expired or ran out of views in the background,
+// with the files of a collection. Items are removed when next requested, not
+// when they expire.
+func (h *Handler) expire(id string) {
+	h.jobs.Submit("expire "+id, func(ctx context.Context) error {
+		item, err := h.storage.GetMeta(ctx, id)
+		if err != nil {
+			// Removed already
+			return nil
+		}
+		return h.deleteItem(ctx, item)
+	})
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+//go:embed install.sh
+var installScript string
+
+// handleInstall serves a script installing a curl-based client for this
+// server: curl -fsSL <base_url>/install.sh | sh
+func (h *Handler) handleInstall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(strings.ReplaceAll(installScript, "{{BASE_URL}}", h.config.BaseURL)))
+}
@@ -0,0 +1,95 @@
+#!/bin/sh
+# Installs share, a client for {{BASE_URL}} that only needs curl:
+#
+#   curl -fsSL {{BASE_URL}}/install.sh | sh
+#
+# The command is written to ~/.local/bin, or $SHARE_INSTALL_DIR if set.
+set -eu
+
+dir="${SHARE_INSTALL_DIR:-$HOME/.local/bin}"
+mkdir -p "$dir"
+
+cat > "$dir/share" <<'EOF'
+#!/bin/sh
+# share: upload a file, or stdin, and print its URL
+#
+#   share notes.md
+#   make 2>&1 | share -e 24h
+#
+# The token is taken from $SHARE_TOKEN or ~/.config/share/config.yaml, like
+# the share CLI does.
+set -eu
+
+usage() {
+    echo "usage: share [-e expiry] [-v max-views] [-r] [file]" >&2
+    echo "  -e  expire after a duration like 1h or 7d" >&2
+    echo "  -v  remove after being opened this many times" >&2
+    echo "  -r  show the raw file instead of the rendered view" >&2
+    exit 2
+}
+
+config="${XDG_CONFIG_HOME:-$HOME/.config}/share/config.yaml"
+setting() {
+    if [ -f "$config" ]; then
+        sed -n "s/^$1:[[:space:]]*//p" "$config" | tr -d "\"'" | head -n 1
+    fi
+}
+
+server="${SHARE_SERVER:-$(setting server)}"
+server="${server:-{{BASE_URL}}}"
+token="${SHARE_TOKEN:-$(setting token)}"
+if [ -z "$token" ]; then
+    echo "share: no token, set SHARE_TOKEN or add it to $config" >&2
+    exit 1
+fi
+
+expires=""
+views=""
+render=""
+while getopts "e:v:rh" opt; do
+    case "$opt" in
+        e) expires="$OPTARG" ;;
+        v) views="$OPTARG" ;;
+        r) render="raw" ;;
+        *) usage ;;
+    esac
+done
+shift $((OPTIND - 1))
+[ $# -le 1 ] || usage
+
+# Percent-encodes a filename for the URL, byte by byte
+encode() (
+    LC_ALL=C
+    s="$1"
+    while [ -n "$s" ]; do
+        rest="${s#?}"
+        c="${s%"$rest"}"
+        case "$c" in
+            [a-zA-Z0-9._~-]) printf '%s' "$c" ;;
+            *) printf '%%%02X' "'$c" ;;
+        esac
+        s="$rest"
+    done
+)
+
+if [ $# -eq 1 ]; then
+    file="$1"
+    name=$(encode "$(basename "$file")")
+else
+    file="-"
+    name=""
+fi
+
+curl -fsS -T "$file" -H "Authorization: Bearer $token" \
+    ${expires:+-H "X-Share-Expires: $expires"} \
+    ${views:+-H "X-Share-Max-Views: $views"} \
+    ${render:+-H "X-Share-Render: $render"} \
+    "${server%/}/api/upload/$name"
+EOF
+chmod +x "$dir/share"
+
+echo "Installed $dir/share"
+case ":$PATH:" in
+    *":$dir:"*) ;;
+    *) echo "Add $dir to your PATH to use it" ;;
+esac
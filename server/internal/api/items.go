@@ -0,0 +1,192 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Fileri/share/server/internal/render"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// maxItemUpdate is the largest settings document PATCH /api/items/<id> takes
+const maxItemUpdate = 64 << 10
+
+// handleItems serves changes to existing items: PUT /api/items/<id> replaces
+// the content, PATCH /api/items/<id> its settings, GET
+// /api/items/<id>/revisions lists its versions
+func (h *Handler) handleItems(w http.ResponseWriter, r *http.Request) {
+	token := requestToken(r)
+
+	if !h.isValidToken(token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/items/"), "/")
+	if id == "" {
+		http.Error(w, "No ID provided", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case sub == "" && r.Method == http.MethodPut:
+		h.replaceItem(w, r, id, token)
+	case sub == "" && r.Method == http.MethodPatch:
+		h.updateItem(w, r, id, token)
+	case sub == "revisions" && r.Method == http.MethodGet:
+		h.listRevisions(w, r, id, token)
+	case sub == "" || sub == "revisions":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// ownItem returns an item if it was uploaded with the token, answering the
+// request otherwise
+func (h *Handler) ownItem(w http.ResponseWriter, r *http.Request, id string, token string) (*storage.Item, bool) {
+	item, err := h.storage.GetMeta(r.Context(), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	if item.OwnerToken != token {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return item, true
+}
+
+// itemUpdate is the body of PATCH /api/items/<id>. Settings left out are kept,
+// an empty expiry, password or description removes it.
+type itemUpdate struct {
+	Filename    *string `json:"filename"`
+	ContentType *string `json:"content_type"`
+	Render      *string `json:"render"`
+	Expires     *string `json:"expires"` // a duration from now like "7d", or an RFC 3339 time
+	Password    *string `json:"password"`
+	Description *string `json:"description"`
+}
+
+// updateItem changes the settings of an item, leaving its content as is
+func (h *Handler) updateItem(w http.ResponseWriter, r *http.Request, id string, token string) {
+	var update itemUpdate
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxItemUpdate))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Changes to an item are made one at a time
+	h.itemsMu.Lock()
+	defer h.itemsMu.Unlock()
+
+	item, ok := h.ownItem(w, r, id, token)
+	if !ok {
+		return
+	}
+
+	contentType := item.ContentType
+	if update.Filename != nil {
+		item.Filename = *update.Filename
+	}
+	if update.ContentType != nil {
+		if _, _, err := mime.ParseMediaType(*update.ContentType); err != nil {
+			http.Error(w, "Invalid content type", http.StatusBadRequest)
+			return
+		}
+		// The content of a collection is its list of files
+		if (item.ContentType == render.CollectionType) != (*update.ContentType == render.CollectionType) {
+			http.Error(w, "Content type of collections cannot be changed", http.StatusBadRequest)
+			return
+		}
+		item.ContentType = *update.ContentType
+	}
+	if update.Render != nil {
+		switch *update.Render {
+		case "auto", "raw", "render":
+			item.RenderMode = *update.Render
+		default:
+			http.Error(w, "Invalid render mode", http.StatusBadRequest)
+			return
+		}
+	}
+	if update.Expires != nil {
+		expiresAt, err := parseExpiry(*update.Expires, time.Now())
+		if err != nil {
+			http.Error(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+		item.ExpiresAt = expiresAt
+	}
+	if update.Password != nil {
+		item.Password = ""
+		if len(*update.Password) > maxPasswordLength {
+			http.Error(w, "Password too long", http.StatusBadRequest)
+			return
+		}
+		if *update.Password != "" {
+			hash, err := hashPassword(*update.Password)
+			if err != nil {
+				log.Printf("Failed to update %s: %v", id, err)
+				http.Error(w, "Failed to update", http.StatusInternalServerError)
+				return
+			}
+			item.Password = hash
+		}
+	}
+	if update.Description != nil {
+		item.Description = strings.TrimSpace(*update.Description)
+	}
+
+	if err := h.storage.UpdateMeta(r.Context(), id, item); err != nil {
+		// Changed through another instance since it was read
+		if errors.Is(err, storage.ErrItemChanged) {
+			http.Error(w, "Item was changed, try again", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to update %s: %v", id, err)
+		http.Error(w, "Failed to update", http.StatusInternalServerError)
+		return
+	}
+
+	// Previews and extracted text depend on the content type, rendered
+	// pages on all of it
+	h.itemDeleted(id)
+	if item.ContentType != contentType {
+		h.itemReplaced(r.Context(), item)
+	}
+
+	response := struct {
+		ID          string `json:"id"`
+		URL         string `json:"url"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		Render      string `json:"render"`
+		Expires     string `json:"expires,omitempty"`
+		Protected   bool   `json:"protected,omitempty"`
+		Description string `json:"description,omitempty"`
+	}{
+		ID:          item.ID,
+		URL:         h.config.BaseURL + "/" + item.ID,
+		Filename:    item.Filename,
+		ContentType: item.ContentType,
+		Render:      item.RenderMode,
+		Protected:   item.Password != "",
+		Description: item.Description,
+	}
+	if item.ExpiresAt != nil {
+		response.Expires = item.ExpiresAt.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fileri/share/server/internal/imaging"
+	"github.com/Fileri/share/server/internal/preview"
+	"github.com/Fileri/share/server/internal/render"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// maxOEmbedImage bounds how much of an image is read to find its dimensions
+const maxOEmbedImage = 1024 * 1024
+
+// oEmbedResponse is the oEmbed 1.0 description of a share. Images are of
+// type photo, everything else is a link.
+type oEmbedResponse struct {
+	Version         string `json:"version"`
+	Type            string `json:"type"`
+	Title           string `json:"title,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	CacheAge        int    `json:"cache_age,omitempty"`
+	URL             string `json:"url,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+}
+
+// describable reports whether a share may be described to link previews:
+// not if the uploader turned them off, or if it or the collection it was
+// shared in is protected, expired or out of views
+func (h *Handler) describable(ctx context.Context, item *storage.Item) bool {
+	if item.NoPreview || item.Password != "" {
+		return false
+	}
+	// Files of a collection are held to its limits, as by admit
+	limits := item
+	if item.Collection != "" {
+		collection, err := h.storage.GetMeta(ctx, item.Collection)
+		if err != nil || collection.NoPreview || collection.Password != "" {
+			return false
+		}
+		limits = collection
+	}
+	if limits.Expired(time.Now()) {
+		return false
+	}
+	return limits.MaxViews == 0 || h.viewCount(ctx, limits.ID).Count < limits.MaxViews
+}
+
+// linkPreview returns the URLs of a share for its OpenGraph tags, nil if it
+// may not be described
+func (h *Handler) linkPreview(ctx context.Context, item *storage.Item) *render.LinkPreview {
+	if !h.describable(ctx, item) {
+		return nil
+	}
+
+	shareURL := h.config.BaseURL + "/" + item.ID
+	p := &render.LinkPreview{
+		URL:         shareURL,
+		RawURL:      shareURL + "/raw",
+		OEmbedURL:   h.config.BaseURL + "/oembed?" + url.Values{"url": {shareURL}}.Encode(),
+		Size:        item.Size,
+		Description: item.Description,
+	}
+	if h.previews != nil && h.previews.CanGenerate(item.ContentType) {
+		p.ImageURL = shareURL + "/thumb"
+	}
+	return p
+}
+
+// handleOEmbed describes a share for chat apps and other consumers that
+// unfurl links: /oembed?url=<share URL>
+func (h *Handler) handleOEmbed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if format := query.Get("format"); format != "" && format != "json" {
+		http.Error(w, "Only JSON is supported", http.StatusNotImplemented)
+		return
+	}
+
+	// Only links to this server's shares are described
+	base, err := url.Parse(h.config.BaseURL)
+	if err != nil {
+		http.Error(w, "Invalid server URL", http.StatusInternalServerError)
+		return
+	}
+	target, err := url.Parse(query.Get("url"))
+	if err != nil || !strings.EqualFold(target.Host, base.Host) {
+		http.NotFound(w, r)
+		return
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(target.Path, base.Path), "/"), "/")
+
+	ctx := r.Context()
+	item, err := h.storage.GetMeta(ctx, id)
+	if err != nil || !h.describable(ctx, item) {
+		http.NotFound(w, r)
+		return
+	}
+
+	shareURL := h.config.BaseURL + "/" + item.ID
+	response := oEmbedResponse{
+		Version:      "1.0",
+		Type:         "link",
+		Title:        item.Filename,
+		ProviderName: base.Host,
+		ProviderURL:  h.config.BaseURL,
+		CacheAge:     3600,
+	}
+	if response.Title == "" {
+		response.Title = "Shared Content"
+	}
+
+	// Thumbnails are generated in the background, so may not exist (yet)
+	if thumb, err := h.storage.GetDerived(ctx, item.ID, preview.ThumbnailName); err == nil {
+		cfg, _, err := image.DecodeConfig(thumb)
+		thumb.Close()
+		if err == nil {
+			response.ThumbnailURL = shareURL + "/thumb"
+			response.ThumbnailWidth, response.ThumbnailHeight = cfg.Width, cfg.Height
+		}
+	}
+
+	// Images are embedded directly if they fit the consumer's bounds
+	if strings.HasPrefix(item.ContentType, "image/") {
+		if content, _, err := h.storage.Get(ctx, item.ID); err == nil {
+			head, _ := io.ReadAll(io.LimitReader(content, maxOEmbedImage))
+			content.Close()
+			if width, height, ok := imaging.Dimensions(head); ok && fits(width, query.Get("maxwidth")) && fits(height, query.Get("maxheight")) {
+				response.Type = "photo"
+				response.URL = shareURL + "/raw"
+				response.Width, response.Height = width, height
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// fits reports whether a dimension is within an optional maxwidth or
+// maxheight parameter
+func fits(size int, limit string) bool {
+	n, err := strconv.Atoi(limit)
+	return err != nil || n <= 0 || size <= n
+}
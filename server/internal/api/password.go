@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/storage"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is the longest share password, in bytes, bcrypt hashes
+const maxPasswordLength = 72
+
+// hashPassword returns the bcrypt hash of a share password as it is stored
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkPassword reports whether password matches a hash from hashPassword,
+// or a "sha256:<salt>:<digest>" hash stored by earlier versions
+func checkPassword(hash string, password string) bool {
+	if !strings.HasPrefix(hash, "sha256:") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	parts := strings.Split(hash, ":")
+	if len(parts) != 3 || parts[0] != "sha256" {
+		return false
+	}
+	salt, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	digest, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(password))
+	return hmac.Equal(digest, mac.Sum(nil))
+}
+
+// unlocked reports whether a request may view an item, which takes the
+// password of a protected share, or of the collection it was shared in, as
+// Basic auth
+func (h *Handler) unlocked(ctx context.Context, r *http.Request, item *storage.Item) bool {
+	hash := item.Password
+	if hash == "" && item.Collection != "" {
+		if collection, err := h.storage.GetMeta(ctx, item.Collection); err == nil {
+			hash = collection.Password
+		}
+	}
+	if hash == "" {
+		return true
+	}
+
+	_, password, ok := r.BasicAuth()
+	return ok && checkPassword(hash, password)
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/render"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// revisionName is the derived artifact holding a previous version of an
+// item's content
+func revisionName(number int) string {
+	return "revisions/" + strconv.Itoa(number)
+}
+
+// replaceItem stores new content under an existing ID, sent as a raw body or
+// a multipart form like an upload. The content it replaces is kept as a
+// revision, the oldest revisions beyond the configured number are removed.
+func (h *Handler) replaceItem(w http.ResponseWriter, r *http.Request, id string, token string) {
+	if h.maxFileSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxFileSize)
+	}
+
+	// Replacements of an item are made one at a time
+	h.itemsMu.Lock()
+	defer h.itemsMu.Unlock()
+
+	ctx := r.Context()
+	item, ok := h.ownItem(w, r, id, token)
+	if !ok {
+		return
+	}
+	if item.ContentType == render.CollectionType {
+		http.Error(w, "Collections cannot be replaced", http.StatusBadRequest)
+		return
+	}
+
+	var content io.Reader = r.Body
+	contentType := r.Header.Get("Content-Type")
+	filename := r.URL.Query().Get("filename")
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "No file provided", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content = file
+		contentType = header.Header.Get("Content-Type")
+		if filename == "" {
+			filename = header.Filename
+		}
+	}
+
+	// The content it replaces is kept as a revision
+	previous := storage.Revision{
+		Number:      item.CurrentRevision(),
+		Filename:    item.Filename,
+		ContentType: item.ContentType,
+		Size:        item.Size,
+		SHA256:      item.SHA256,
+		CreatedAt:   item.CreatedAt,
+	}
+	if item.UpdatedAt != nil {
+		previous.CreatedAt = *item.UpdatedAt
+	}
+
+	now := time.Now().UTC()
+	item.Revision = previous.Number + 1
+	item.UpdatedAt = &now
+	item.ContentType = contentType
+	if filename != "" {
+		item.Filename = filename
+	}
+	content, _, err := h.prepareUpload(r, content, item)
+	if err != nil {
+		uploadFailed(w, err)
+		return
+	}
+
+	// The new content is received whole before anything is replaced, so a
+	// failed upload leaves the item as it was
+	staged, err := os.CreateTemp("", "share-replace-*")
+	if err != nil {
+		uploadFailed(w, fmt.Errorf("failed to create temp file: %w", err))
+		return
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	if _, err := io.Copy(staged, content); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read upload", http.StatusBadRequest)
+		return
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		uploadFailed(w, fmt.Errorf("failed to read temp file: %w", err))
+		return
+	}
+
+	kept := h.keepRevisions > 0
+	if kept {
+		current, _, err := h.storage.Get(ctx, id)
+		if err != nil {
+			log.Printf("Failed to read %s to keep a revision: %v", id, err)
+			http.Error(w, "Failed to keep revision", http.StatusInternalServerError)
+			return
+		}
+		err = h.storage.PutDerived(ctx, id, revisionName(previous.Number), current)
+		current.Close()
+		if err != nil {
+			log.Printf("Failed to keep revision of %s: %v", id, err)
+			http.Error(w, "Failed to keep revision", http.StatusInternalServerError)
+			return
+		}
+		item.Revisions = append(item.Revisions, previous)
+	}
+
+	// The oldest revisions are dropped once the new content is stored
+	var pruned []storage.Revision
+	if excess := len(item.Revisions) - max(h.keepRevisions, 0); excess > 0 {
+		pruned = slices.Clone(item.Revisions[:excess])
+		item.Revisions = slices.Clone(item.Revisions[excess:])
+	}
+
+	if err := h.storage.Put(ctx, id, staged, item); err != nil {
+		if kept {
+			if err := h.storage.DeleteDerived(ctx, id, revisionName(previous.Number)); err != nil {
+				log.Printf("Failed to delete revision %d of %s: %v", previous.Number, id, err)
+			}
+		}
+		uploadFailed(w, err)
+		return
+	}
+
+	for _, rev := range pruned {
+		if err := h.storage.DeleteDerived(ctx, id, revisionName(rev.Number)); err != nil {
+			log.Printf("Failed to delete revision %d of %s: %v", rev.Number, id, err)
+		}
+	}
+	h.itemReplaced(ctx, item)
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(h.config.BaseURL + "/" + id + "\n"))
+}
+
+// listRevisions returns the kept versions of an item, oldest first and the
+// current one last
+func (h *Handler) listRevisions(w http.ResponseWriter, r *http.Request, id string, token string) {
+	item, ok := h.ownItem(w, r, id, token)
+	if !ok {
+		return
+	}
+
+	type revision struct {
+		Revision    int    `json:"revision"`
+		URL         string `json:"url"`
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+		Created     string `json:"created"`
+		Current     bool   `json:"current,omitempty"`
+	}
+
+	response := make([]revision, 0, len(item.Revisions)+1)
+	for _, rev := range item.Revisions {
+		response = append(response, revision{
+			Revision:    rev.Number,
+			URL:         h.config.BaseURL + "/" + id + "/v/" + strconv.Itoa(rev.Number),
+			Filename:    rev.Filename,
+			ContentType: rev.ContentType,
+			Size:        rev.Size,
+			Created:     rev.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	updated := item.CreatedAt
+	if item.UpdatedAt != nil {
+		updated = *item.UpdatedAt
+	}
+	response = append(response, revision{
+		Revision:    item.CurrentRevision(),
+		URL:         h.config.BaseURL + "/" + id,
+		Filename:    item.Filename,
+		ContentType: item.ContentType,
+		Size:        item.Size,
+		Created:     updated.Format(time.RFC3339),
+		Current:     true,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// revisionNote describes the current version of a replaced item for its
+// pages, nil if it was never replaced
+func revisionNote(item *storage.Item) *render.RevisionNote {
+	if item.UpdatedAt == nil {
+		return nil
+	}
+	note := &render.RevisionNote{
+		Number:  item.CurrentRevision(),
+		Updated: *item.UpdatedAt,
+		Latest:  true,
+	}
+	if n := len(item.Revisions); n > 0 {
+		note.LinkURL = "/" + item.ID + "/v/" + strconv.Itoa(item.Revisions[n-1].Number)
+	}
+	return note
+}
+
+// serveRevision serves a previous version of an item: /<id>/v/<n> in the
+// item's default view, /<id>/v/<n>/raw as is
+func (h *Handler) serveRevision(w http.ResponseWriter, r *http.Request, id string, parts []string) {
+	ctx := r.Context()
+
+	raw := len(parts) == 2 && parts[1] == "raw"
+	number, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 || len(parts) == 2 && !raw {
+		http.NotFound(w, r)
+		return
+	}
+
+	item, err := h.storage.GetMeta(ctx, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if number == item.CurrentRevision() {
+		target := "/" + id
+		if raw {
+			target += "/raw"
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+	rev := item.FindRevision(number)
+	if rev == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := h.storage.GetDerived(ctx, id, revisionName(number))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+
+	// The version as it was uploaded
+	old := *item
+	old.Filename = rev.Filename
+	old.ContentType = rev.ContentType
+	old.Size = rev.Size
+	old.SHA256 = rev.SHA256
+	rawURL := "/" + id + "/v/" + strconv.Itoa(number) + "/raw"
+
+	// Archive members and hosted pages are those of the current version, so
+	// previous versions of them are only served as files
+	views := h.views(&old)
+	if raw || old.RenderMode == "raw" || isHTML(old.ContentType) || archive.IsArchive(old.ContentType, old.Filename) || len(views) == 0 {
+		serveRevisionFile(w, &old, content)
+		return
+	}
+
+	opts := h.renderOpts
+	opts.Theme = h.pageTheme(r, item)
+	opts.Revision = &render.RevisionNote{
+		Number:  number,
+		Updated: rev.CreatedAt,
+		LinkURL: "/" + id,
+	}
+
+	view := views[0]
+	limits := view.Limits()
+	tooLarge := h.renderMaxSize > 0 && old.Size > h.renderMaxSize
+	if limits.Streams && (tooLarge || opts.HighlightMaxSize > 0 && old.Size > opts.HighlightMaxSize) {
+		var text io.Reader = content
+		maxLines := 0
+		if tooLarge {
+			text = io.LimitReader(content, h.renderMaxSize)
+			maxLines = h.previewLines
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", view.Policy(opts))
+		err := render.StreamText(w, view, old.ContentType, text, old.Size, old.Filename, rawURL, maxLines, opts)
+		if errors.Is(err, render.ErrBinary) {
+			// Nothing was written, so the file can be served as is instead
+			w.Header().Del("Content-Security-Policy")
+			content, err := h.storage.GetDerived(ctx, id, revisionName(number))
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			defer content.Close()
+			serveRevisionFile(w, &old, content)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to stream revision %d of %s: %v", number, id, err)
+		}
+		return
+	}
+
+	var data []byte
+	if !limits.NoContent {
+		if data, err = io.ReadAll(content); err != nil {
+			http.Error(w, "Failed to read content", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	rendered, used, err := render.RenderWith(views, old.ContentType, data, old.Filename, rawURL, opts)
+	if err != nil {
+		// Views that take no content have left it unread
+		var file io.Reader = content
+		if !limits.NoContent {
+			file = bytes.NewReader(data)
+		}
+		serveRevisionFile(w, &old, file)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", used.Policy(opts))
+	w.Write(rendered)
+}
+
+// serveRevisionFile serves a previous version as is, with the same headers
+// as the current version's raw file
+func serveRevisionFile(w http.ResponseWriter, item *storage.Item, content io.Reader) {
+	setRawHeaders(w, item)
+	io.Copy(w, content)
+}
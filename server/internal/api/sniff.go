@@ -0,0 +1,194 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/render"
+)
+
+// sniffLen is how much of an upload is looked at to recognize its format
+const sniffLen = 4096
+
+// signature is the magic number of a format at a given offset
+type signature struct {
+	offset      int
+	magic       string
+	contentType string
+}
+
+// signatures are formats http.DetectContentType does not know
+var signatures = []signature{
+	{257, "ustar", "application/x-tar"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xfd7zXZ\x00", "application/x-xz"},
+	{0, "\x28\xb5\x2f\xfd", "application/zstd"},
+	{0, "7z\xbc\xaf\x27\x1c", "application/x-7z-compressed"},
+	{0, "fLaC", "audio/flac"},
+	{0, "II*\x00", "image/tiff"},
+	{0, "MM\x00*", "image/tiff"},
+	{4, "ftypavif", "image/avif"},
+	{4, "ftypheic", "image/heic"},
+	{4, "ftypmif1", "image/heif"},
+	{0, "\x7fELF", "application/x-executable"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+}
+
+// interpreters maps the program named in a shebang line to a script type
+var interpreters = map[string]string{
+	"sh":      "text/x-shellscript",
+	"bash":    "text/x-shellscript",
+	"zsh":     "text/x-shellscript",
+	"dash":    "text/x-shellscript",
+	"ksh":     "text/x-shellscript",
+	"python":  "text/x-python",
+	"python3": "text/x-python",
+	"node":    "application/javascript",
+	"deno":    "application/javascript",
+	"bun":     "application/javascript",
+	"ruby":    "text/x-ruby",
+}
+
+// sniffContentType determines the type of content from its first bytes:
+// magic numbers of binary formats, then the shape of text. Unrecognized
+// binary content is application/octet-stream.
+func sniffContentType(content []byte) string {
+	if len(content) == 0 {
+		return "text/plain"
+	}
+
+	for _, sig := range signatures {
+		if bytes.HasPrefix(content[min(sig.offset, len(content)):], []byte(sig.magic)) {
+			return sig.contentType
+		}
+	}
+
+	detected := http.DetectContentType(content)
+	if !strings.HasPrefix(detected, "text/plain") {
+		return detected
+	}
+	if render.IsBinary(content) {
+		return "application/octet-stream"
+	}
+
+	text := string(content)
+	switch {
+	case strings.HasPrefix(text, "#!"):
+		return scriptType(text)
+	case isCast(text):
+		return "application/x-asciicast"
+	case looksLikeJSON(content):
+		if strings.Contains(text, `"nbformat"`) && strings.Contains(text, `"cells"`) {
+			return "application/x-ipynb+json"
+		}
+		return "application/json"
+	case looksLikeDiff(text):
+		return "text/x-diff"
+	case looksLikeMarkdown(text):
+		return "text/markdown"
+	}
+	return detected
+}
+
+// scriptType returns the type of a script from its shebang line, which may
+// run the interpreter through env
+func scriptType(text string) string {
+	line, _, _ := strings.Cut(text[2:], "\n")
+	fields := strings.Fields(line)
+	if len(fields) > 1 && path.Base(fields[0]) == "env" {
+		fields = fields[1:]
+		if fields[0] == "-S" && len(fields) > 1 {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) > 0 {
+		if ct, ok := interpreters[path.Base(fields[0])]; ok {
+			return ct
+		}
+	}
+	return "text/plain"
+}
+
+// isCast reports whether text starts with an asciinema v2 header
+func isCast(text string) bool {
+	line, _, _ := strings.Cut(text, "\n")
+	var header struct {
+		Version int `json:"version"`
+		Width   int `json:"width"`
+	}
+	return json.Unmarshal([]byte(line), &header) == nil && header.Version == 2 && header.Width > 0
+}
+
+// looksLikeJSON reports whether content is an object or array that is valid
+// JSON as far as it goes, since only the start of a file may be given
+func looksLikeJSON(content []byte) bool {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	for tokens := 0; ; tokens++ {
+		_, err := dec.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			// Cut off mid-value, the rest was fine
+			return tokens > 1 && errors.Is(err, io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+// looksLikeDiff reports whether text starts like a unified diff, a git diff
+// or a patch mailed by git format-patch
+func looksLikeDiff(text string) bool {
+	if strings.HasPrefix(text, "diff --git ") || (strings.HasPrefix(text, "From ") && strings.Contains(text, "\n---\n")) {
+		return true
+	}
+	return strings.HasPrefix(text, "--- ") && strings.Contains(text, "\n+++ ") && strings.Contains(text, "\n@@ ")
+}
+
+var (
+	markdownHeading = regexp.MustCompile(`^#{1,6} \S`)
+	markdownList    = regexp.MustCompile(`^\s*([-*+]|\d+\.) \S`)
+	markdownLink    = regexp.MustCompile(`\[[^\]]+\]\([^)\s]+\)`)
+	markdownTable   = regexp.MustCompile(`^\|.*\|\s*$`)
+	markdownBold    = regexp.MustCompile(`\*\*\S[^*]*\S\*\*`)
+)
+
+// looksLikeMarkdown reports whether text uses at least two kinds of Markdown
+// syntax. Headings must be followed by a blank line, which sets them apart
+// from comments in scripts and config files.
+func looksLikeMarkdown(text string) bool {
+	lines := strings.Split(text, "\n")
+	kinds := map[string]bool{}
+	for i, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "```"):
+			kinds["fence"] = true
+		case markdownHeading.MatchString(line) && (i+1 == len(lines) || strings.TrimSpace(lines[i+1]) == ""):
+			kinds["heading"] = true
+		case markdownList.MatchString(line):
+			kinds["list"] = true
+		case strings.HasPrefix(line, "> "):
+			kinds["quote"] = true
+		case markdownTable.MatchString(line):
+			kinds["table"] = true
+		}
+		if markdownLink.MatchString(line) {
+			kinds["link"] = true
+		}
+		if markdownBold.MatchString(line) {
+			kinds["bold"] = true
+		}
+	}
+	return len(kinds) >= 2
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fileri/share/server/internal/imaging"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// Resumable uploads follow the tus protocol, version 1.0.0, with the
+// creation, termination and expiration extensions: https://tus.io/protocols/resumable-upload
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+	tusPrefix      = "/api/tus/"
+)
+
+// uploadCleanupInterval is how often expired resumable uploads are removed
+const uploadCleanupInterval = 10 * time.Minute
+
+// newUploadStore returns the backend's store for resumable uploads, nil if
+// it has none
+func newUploadStore(store storage.Storage) storage.UploadStore {
+	uploads, ok := store.(storage.UploadStore)
+	if !ok {
+		log.Printf("Storage backend does not support resumable uploads")
+		return nil
+	}
+	return uploads
+}
+
+// handleTus serves the tus endpoint: OPTIONS and POST on /api/tus/, HEAD,
+// PATCH and DELETE on /api/tus/<id>
+func (h *Handler) handleTus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if h.uploads == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", tusExtensions)
+		if h.maxFileSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxFileSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	token := requestToken(r)
+	if !h.isValidToken(token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, tusPrefix)
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.createUpload(w, r, token)
+		return
+	}
+	if strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.uploadStatus(w, r, id, token)
+	case http.MethodPatch:
+		h.appendUpload(w, r, id, token)
+	case http.MethodDelete:
+		h.terminateUpload(w, r, id, token)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// createUpload stages a new upload of the declared length. The filename and
+// type come from the filename and filetype metadata, other settings from
+// metadata or the params and headers of a plain upload.
+func (h *Handler) createUpload(w http.ResponseWriter, r *http.Request, token string) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		http.Error(w, "Deferred upload length is not supported", http.StatusBadRequest)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid upload length", http.StatusBadRequest)
+		return
+	}
+	if h.maxFileSize > 0 && length > h.maxFileSize {
+		http.Error(w, "Upload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid upload metadata", http.StatusBadRequest)
+		return
+	}
+
+	if isCollectionType(metadata["filetype"]) {
+		http.Error(w, "Invalid content type", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	id := generateID()
+	item := &storage.Item{
+		ID:          id,
+		Filename:    metadata["filename"],
+		ContentType: metadata["filetype"],
+		CreatedAt:   now,
+		OwnerToken:  token,
+	}
+	if err := setItemOptions(item, func(param string, header string) string {
+		if v, ok := metadata[param]; ok {
+			return v
+		}
+		return uploadOption(r, param, header)
+	}, now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload := &storage.Upload{
+		ID:        id,
+		Length:    length,
+		Item:      item,
+		Strip:     h.shouldStripMetadata(r),
+		CreatedAt: now,
+		ExpiresAt: now.Add(h.uploadExpiry),
+	}
+	if err := h.uploads.CreateUpload(r.Context(), upload); err != nil {
+		log.Printf("Failed to create upload: %v", err)
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	// An empty file is complete as soon as it is created
+	if upload.Complete() {
+		upload.Item.ContentType = uploadContentType(upload.Item.ContentType, upload.Item.Filename, nil)
+		if !h.commitUpload(w, r, upload) {
+			return
+		}
+	}
+
+	w.Header().Set("Location", h.config.BaseURL+tusPrefix+id)
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// uploadStatus reports how much of an upload was received. Uploads that
+// were completed report their full length, so clients resuming them stop.
+func (h *Handler) uploadStatus(w http.ResponseWriter, r *http.Request, id string, token string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	upload, err := h.ownUpload(r.Context(), id, token)
+	if errors.Is(err, storage.ErrUploadNotFound) {
+		item, err := h.storage.GetMeta(r.Context(), id)
+		if err != nil || item.OwnerToken != token {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(item.Size, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(item.Size, 10))
+		w.Header().Set("X-Share-URL", h.config.BaseURL+"/"+id)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		h.uploadError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+}
+
+// appendUpload adds a chunk at the offset the client gives, which must be
+// where the upload stands. The upload is committed as an item with its last
+// chunk, and the share URL returned in the X-Share-URL header.
+func (h *Handler) appendUpload(w http.ResponseWriter, r *http.Request, id string, token string) {
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, "Content type must be "+tusContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid upload offset", http.StatusBadRequest)
+		return
+	}
+
+	// Chunks of an upload are appended one at a time
+	if !h.holdUpload(id) {
+		http.Error(w, "Upload is in use", http.StatusLocked)
+		return
+	}
+	defer h.releaseUpload(id)
+
+	ctx := r.Context()
+	upload, err := h.ownUpload(ctx, id, token)
+	if err != nil {
+		h.uploadError(w, r, err)
+		return
+	}
+	if offset != upload.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		http.Error(w, "Upload offset does not match", http.StatusConflict)
+		return
+	}
+
+	// Content past the declared length is refused, what came before it kept
+	// if the client did not declare its size
+	if r.ContentLength > upload.Length-upload.Offset {
+		http.Error(w, "Upload exceeds its length", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var content io.Reader = http.MaxBytesReader(w, r.Body, upload.Length-upload.Offset)
+
+	// The type is detected from the first chunk, as for plain uploads
+	if upload.Offset == 0 {
+		peek := bufio.NewReaderSize(content, sniffLen)
+		head, _ := peek.Peek(sniffLen)
+		upload.Item.ContentType = uploadContentType(upload.Item.ContentType, upload.Item.Filename, head)
+		content = peek
+	}
+
+	// Each chunk extends the time left to finish the upload
+	upload.ExpiresAt = time.Now().UTC().Add(h.uploadExpiry)
+
+	if err := h.uploads.AppendUpload(ctx, upload, content); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Upload exceeds its length", http.StatusRequestEntityTooLarge)
+			return
+		}
+		// Appended to through another instance
+		if errors.Is(err, storage.ErrUploadConflict) {
+			http.Error(w, "Upload is in use", http.StatusLocked)
+			return
+		}
+		// Committed or removed through another instance
+		if errors.Is(err, storage.ErrUploadNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		log.Printf("Failed to append to upload %s: %v", id, err)
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	if upload.Complete() && !h.commitUpload(w, r, upload) {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Expires", upload.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commitUpload stores a complete upload as an item, answering the request
+// with an error if that fails
+func (h *Handler) commitUpload(w http.ResponseWriter, r *http.Request, upload *storage.Upload) bool {
+	ctx := r.Context()
+	if err := h.uploads.CommitUpload(ctx, upload); err != nil {
+		log.Printf("Failed to commit upload %s: %v", upload.ID, err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return false
+	}
+
+	// Image metadata can only be removed from the whole file
+	item := upload.Item
+	if upload.Strip && imaging.CanStrip(item.ContentType) {
+		if err := h.stripStoredMetadata(ctx, item); err != nil {
+			log.Printf("Failed to strip metadata of %s: %v", item.ID, err)
+			h.storage.Delete(ctx, item.ID)
+			http.Error(w, "Failed to strip image metadata", http.StatusUnprocessableEntity)
+			return false
+		}
+	}
+
+	h.itemStored(item)
+	w.Header().Set("X-Share-URL", h.config.BaseURL+"/"+item.ID)
+	return true
+}
+
+// stripStoredMetadata replaces a stored image with one without its metadata
+func (h *Handler) stripStoredMetadata(ctx context.Context, item *storage.Item) error {
+	content, _, err := h.storage.Get(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	stripped, err := imaging.StripMetadata(item.ContentType, data)
+	if err != nil {
+		return err
+	}
+	return h.storage.Put(ctx, item.ID, bytes.NewReader(stripped), item)
+}
+
+// terminateUpload removes an upload that is no longer wanted
+func (h *Handler) terminateUpload(w http.ResponseWriter, r *http.Request, id string, token string) {
+	if !h.holdUpload(id) {
+		http.Error(w, "Upload is in use", http.StatusLocked)
+		return
+	}
+	defer h.releaseUpload(id)
+
+	if _, err := h.ownUpload(r.Context(), id, token); err != nil {
+		h.uploadError(w, r, err)
+		return
+	}
+	if err := h.uploads.DeleteUpload(r.Context(), id); err != nil {
+		log.Printf("Failed to delete upload %s: %v", id, err)
+		http.Error(w, "Failed to delete upload", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownUpload returns an unexpired upload created with the token. Uploads of
+// other tokens are reported as not found.
+func (h *Handler) ownUpload(ctx context.Context, id string, token string) (*storage.Upload, error) {
+	upload, err := h.uploads.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Item == nil || upload.Item.OwnerToken != token {
+		return nil, storage.ErrUploadNotFound
+	}
+	if upload.Expired(time.Now()) {
+		h.uploads.DeleteUpload(ctx, id)
+		return nil, storage.ErrUploadNotFound
+	}
+	return upload, nil
+}
+
+func (h *Handler) uploadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrUploadNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	log.Printf("Failed to get upload: %v", err)
+	http.Error(w, "Failed to get upload", http.StatusInternalServerError)
+}
+
+// holdUpload marks an upload as in use by a request on this instance,
+// returning false if another request already holds it
+func (h *Handler) holdUpload(id string) bool {
+	h.uploadsMu.Lock()
+	defer h.uploadsMu.Unlock()
+	if h.uploadsHeld[id] {
+		return false
+	}
+	h.uploadsHeld[id] = true
+	return true
+}
+
+func (h *Handler) releaseUpload(id string) {
+	h.uploadsMu.Lock()
+	defer h.uploadsMu.Unlock()
+	delete(h.uploadsHeld, id)
+}
+
+// uploadCleanupLoop removes resumable uploads that expired unfinished
+func (h *Handler) uploadCleanupLoop() {
+	ticker := time.NewTicker(uploadCleanupInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		ctx := context.Background()
+		uploads, err := h.uploads.ListUploads(ctx)
+		if err != nil {
+			log.Printf("Failed to clean up expired uploads: %v", err)
+			continue
+		}
+		for _, upload := range uploads {
+			if upload.Expired(now) {
+				h.uploads.DeleteUpload(ctx, upload.ID)
+			}
+		}
+	}
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated keys,
+// each followed by a space and its base64 encoded value unless it has none
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// userContentCSP lets shared pages run their own scripts and styles. They are
+// served from a separate origin, so they cannot reach the main domain's cookies
+// or API, only embedding them in other sites is blocked.
+const userContentCSP = "default-src * data: blob: 'unsafe-inline' 'unsafe-eval'; frame-ancestors 'none'"
+
+// sandboxCSP is used for active content (HTML, SVG) served on the main domain,
+// giving it a unique origin without script
+const sandboxCSP = "sandbox; default-src 'none'; img-src 'self' data:; media-src 'self'; style-src 'unsafe-inline'"
+
+// isActiveContent reports whether a browser might run script in the content
+// type when it is opened directly. Any XML type is rendered as a document
+// that can, so only types known to be passive are not active.
+func isActiveContent(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	if kind, _, _ := strings.Cut(mediaType, "/"); kind == "image" || kind == "audio" || kind == "video" {
+		return false
+	}
+	switch mediaType {
+	case "text/plain", "text/csv", "application/json", "application/pdf", "application/octet-stream",
+		"application/zip", "application/gzip", "application/x-tar":
+		return false
+	}
+	return true
+}
+
+func isHTML(contentType string) bool {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	ct = strings.TrimSpace(ct)
+	return ct == "text/html" || ct == "application/xhtml+xml"
+}
+
+// isUserContentHost reports whether a request is for the usercontent domain
+func (h *Handler) isUserContentHost(r *http.Request) bool {
+	return h.userContent != nil && strings.EqualFold(r.Host, h.userContent.Host)
+}
+
+// userContentURL returns where an item is hosted on the usercontent domain
+func (h *Handler) userContentURL(id string) string {
+	return strings.TrimSuffix(h.userContent.String(), "/") + "/" + id + "/"
+}
+
+// serveUserContent serves HTML shares and sites from archives on the
+// usercontent domain: /<id>/ is the page or the archive's index.html, and
+// /<id>/<path> is a file relative to it. Nothing else is reachable there.
+func (h *Handler) serveUserContent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Reached through the share, where the view was counted
+	if !h.admit(w, r, id, false) {
+		return
+	}
+
+	item, err := h.storage.GetMeta(r.Context(), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Relative links only resolve against /<id>/
+	if !strings.HasPrefix(r.URL.Path, "/"+id+"/") {
+		http.Redirect(w, r, "/"+id+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", userContentCSP)
+
+	if isHTML(item.ContentType) {
+		if name != "" {
+			http.NotFound(w, r)
+			return
+		}
+		content, _, err := h.storage.Get(r.Context(), id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", item.ContentType)
+		io.Copy(w, content)
+		return
+	}
+
+	if archive.IsArchive(item.ContentType, item.Filename) {
+		h.serveSiteFile(w, r, item, name)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// serveSiteFile serves a file of a static site uploaded as an archive. The
+// files of the site are looked up in its listing, which is kept between
+// requests, so only the requested file is read from the archive.
+func (h *Handler) serveSiteFile(w http.ResponseWriter, r *http.Request, item *storage.Item, name string) {
+	ctx := r.Context()
+	if h.archiveMaxSize > 0 && item.Size > h.archiveMaxSize {
+		http.Error(w, "Archive too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	site, err := h.siteIndex(ctx, item)
+	if err != nil {
+		http.Error(w, "Failed to read archive", http.StatusUnprocessableEntity)
+		return
+	}
+	if site.root == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	file := path.Join(site.root, name)
+	if !site.files[file] {
+		// Directories are linked without their trailing slash
+		if site.files[path.Join(file, "index.html")] {
+			http.Redirect(w, r, path.Base(name)+"/", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	content, err := h.openArchive(ctx, item)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer content.Close()
+
+	member, err := archive.ReadFileAt(content, item.Size, file, h.renderOpts.ArchiveLimits)
+	switch {
+	case errors.Is(err, archive.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, archive.ErrTooLarge):
+		http.Error(w, "Archive member too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, "Failed to read archive", http.StatusUnprocessableEntity)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = detectContentType(path.Base(name), member)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(member)
+}
+
+// parseUserContentURL parses the configured usercontent base URL, nil if unset
+func parseUserContentURL(raw string) *url.URL {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		log.Printf("Invalid usercontent base_url %q, HTML hosting disabled", raw)
+		return nil
+	}
+	return u
+}
@@ -12,30 +12,35 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Fileri/share/server/internal/imaging"
 	"github.com/Fileri/share/server/internal/storage"
 	"golang.org/x/net/webdav"
 )
 
 // WebDAVHandler wraps the storage backend for WebDAV access
 type WebDAVHandler struct {
-	storage     storage.Storage
-	tokens      []string
-	handler     *webdav.Handler
-	maxFileSize int64
+	storage       storage.Storage
+	tokens        []string
+	handler       *webdav.Handler
+	maxFileSize   int64
+	stripMetadata bool
+	onStored      func(item *storage.Item) // called after a file is stored, may be nil
+	onDeleted     func(id string)          // called after a file is deleted, may be nil
 }
 
 // NewWebDAV creates a new WebDAV handler
-func NewWebDAV(store storage.Storage, tokens []string, maxFileSize int64) *WebDAVHandler {
+func NewWebDAV(store storage.Storage, tokens []string, maxFileSize int64, locks webdav.LockSystem, stripMetadata bool) *WebDAVHandler {
 	w := &WebDAVHandler{
-		storage:     store,
-		tokens:      tokens,
-		maxFileSize: maxFileSize,
+		storage:       store,
+		tokens:        tokens,
+		maxFileSize:   maxFileSize,
+		stripMetadata: stripMetadata,
 	}
 
 	w.handler = &webdav.Handler{
 		Prefix:     "/webdav",
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: locks,
 	}
 
 	return w
@@ -95,7 +100,13 @@ func (w *WebDAVHandler) RemoveAll(ctx context.Context, name string) error {
 		return os.ErrPermission
 	}
 
-	return w.storage.Delete(ctx, item.ID)
+	if err := w.storage.Delete(ctx, item.ID); err != nil {
+		return err
+	}
+	if w.onDeleted != nil {
+		w.onDeleted(item.ID)
+	}
+	return nil
 }
 
 func (w *WebDAVHandler) Rename(ctx context.Context, oldName, newName string) error {
@@ -203,11 +214,13 @@ func (w *WebDAVHandler) openFile(ctx context.Context, token, name string) (webda
 
 func (w *WebDAVHandler) createFile(ctx context.Context, token, name string) (webdav.File, error) {
 	return &davWriteFile{
-		name:        name,
-		token:       token,
-		storage:     w.storage,
-		buffer:      &bytes.Buffer{},
-		maxFileSize: w.maxFileSize,
+		name:          name,
+		token:         token,
+		storage:       w.storage,
+		buffer:        &bytes.Buffer{},
+		maxFileSize:   w.maxFileSize,
+		stripMetadata: w.stripMetadata,
+		onStored:      w.onStored,
 	}, nil
 }
 
@@ -301,12 +314,14 @@ func (f *davFile) Readdir(count int) ([]os.FileInfo, error)      { return nil, o
 // --- Write file implementation ---
 
 type davWriteFile struct {
-	name        string
-	token       string
-	storage     storage.Storage
-	buffer      *bytes.Buffer
-	maxFileSize int64
-	closed      bool
+	name          string
+	token         string
+	storage       storage.Storage
+	buffer        *bytes.Buffer
+	maxFileSize   int64
+	stripMetadata bool
+	onStored      func(item *storage.Item)
+	closed        bool
 }
 
 func (f *davWriteFile) Close() error {
@@ -326,7 +341,23 @@ func (f *davWriteFile) Close() error {
 		OwnerToken:  f.token,
 	}
 
-	return f.storage.Put(context.Background(), id, f.buffer, item)
+	var content io.Reader = f.buffer
+	if f.stripMetadata && imaging.CanStrip(item.ContentType) {
+		stripped, err := imaging.StripMetadata(item.ContentType, f.buffer.Bytes())
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(stripped)
+	}
+
+	if err := f.storage.Put(context.Background(), id, content, item); err != nil {
+		return err
+	}
+
+	if f.onStored != nil {
+		f.onStored(item)
+	}
+	return nil
 }
 
 func (f *davWriteFile) Read(p []byte) (int, error) { return 0, os.ErrInvalid }
@@ -0,0 +1,321 @@
+// Package archive lists and extracts members of zip and tar archives with
+// limits that guard against zip bombs and path traversal.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an archive has no member with the given path
+	ErrNotFound = errors.New("archive member not found")
+
+	// ErrTooLarge is returned when extracting would exceed a limit
+	ErrTooLarge = errors.New("archive member too large")
+
+	// ErrUnsupported is returned for content that is not a known archive format
+	ErrUnsupported = errors.New("unsupported archive format")
+)
+
+// Limits bounds the work done reading an archive. Zero values mean unlimited.
+type Limits struct {
+	MaxEntries   int   // entries listed
+	MaxEntrySize int64 // uncompressed size of a member that can be extracted
+	MaxTotalSize int64 // uncompressed bytes read from a compressed tar stream
+}
+
+// Entry is a file or directory in an archive
+type Entry struct {
+	Path    string // cleaned, slash-separated, relative
+	Size    int64
+	ModTime time.Time
+	Dir     bool
+}
+
+// Listing is the contents of an archive
+type Listing struct {
+	Entries   []Entry // sorted by path
+	Truncated bool    // true if limits stopped the listing early
+	Skipped   int     // members with unsafe paths or of unsupported types
+}
+
+// IsArchive reports whether the content type or filename is a browsable archive
+func IsArchive(contentType string, filename string) bool {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(ct) {
+	case "application/zip", "application/x-zip-compressed", "application/x-tar", "application/x-gtar":
+		return true
+	}
+
+	name := strings.ToLower(filename)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatAt detects the archive format from the first bytes of r
+func formatAt(r io.ReaderAt) string {
+	head := make([]byte, 262)
+	n, _ := r.ReadAt(head, 0)
+	return format(head[:n])
+}
+
+// format detects the archive format from its first bytes
+func format(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return "zip"
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return "tar.gz"
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return "tar"
+	}
+	return ""
+}
+
+// CleanPath normalizes a member path, returning false if it is absolute or
+// escapes the archive root
+func CleanPath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" {
+		return "", false
+	}
+
+	name = path.Clean(name)
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// List returns the entries of an archive held in memory
+func List(data []byte, limits Limits) (*Listing, error) {
+	return ListAt(bytes.NewReader(data), int64(len(data)), limits)
+}
+
+// ListAt returns the entries of an archive of the given size. Zips are read
+// through their central directory, tars from start to end.
+func ListAt(r io.ReaderAt, size int64, limits Limits) (*Listing, error) {
+	listing := &Listing{}
+	add := func(name string, size int64, modTime time.Time, dir bool) bool {
+		clean, ok := CleanPath(name)
+		if !ok {
+			listing.Skipped++
+			return true
+		}
+		if limits.MaxEntries > 0 && len(listing.Entries) >= limits.MaxEntries {
+			listing.Truncated = true
+			return false
+		}
+		listing.Entries = append(listing.Entries, Entry{Path: clean, Size: size, ModTime: modTime, Dir: dir})
+		return true
+	}
+
+	switch formatAt(r) {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip: %w", err)
+		}
+		for _, f := range zr.File {
+			mode := f.Mode()
+			if !mode.IsRegular() && !mode.IsDir() {
+				listing.Skipped++
+				continue
+			}
+			// The declared size is only displayed, extraction enforces the real one
+			if !add(f.Name, int64(f.UncompressedSize64), f.Modified, mode.IsDir()) {
+				break
+			}
+		}
+
+	case "tar", "tar.gz":
+		tr, err := tarReader(r, size, limits)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if errors.Is(err, ErrTooLarge) {
+				listing.Truncated = true
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tar: %w", err)
+			}
+
+			switch hdr.Typeflag {
+			case tar.TypeReg, tar.TypeDir:
+			default: // links and devices are never followed
+				listing.Skipped++
+				continue
+			}
+			if !add(hdr.Name, hdr.Size, hdr.ModTime, hdr.Typeflag == tar.TypeDir) {
+				break
+			}
+		}
+
+	default:
+		return nil, ErrUnsupported
+	}
+
+	sort.Slice(listing.Entries, func(i, j int) bool {
+		return listing.Entries[i].Path < listing.Entries[j].Path
+	})
+	return listing, nil
+}
+
+// SiteRoot finds the directory holding a static site's index.html: the
+// archive root, or its single top-level directory as produced by zipping a folder
+func SiteRoot(listing *Listing) (string, bool) {
+	topLevel := map[string]bool{}
+	hasIndex := map[string]bool{}
+	for _, e := range listing.Entries {
+		dir, _, _ := strings.Cut(e.Path, "/")
+		topLevel[dir] = true
+		if e.Path == "index.html" {
+			hasIndex["."] = true
+		} else if strings.Count(e.Path, "/") == 1 && path.Base(e.Path) == "index.html" {
+			hasIndex[path.Dir(e.Path)] = true
+		}
+	}
+
+	if hasIndex["."] {
+		return ".", true
+	}
+	if len(topLevel) == 1 {
+		for dir := range topLevel {
+			if hasIndex[dir] {
+				return dir, true
+			}
+		}
+	}
+	return "", false
+}
+
+// ReadFile extracts a regular file from an archive held in memory by its
+// cleaned path
+func ReadFile(data []byte, name string, limits Limits) ([]byte, error) {
+	return ReadFileAt(bytes.NewReader(data), int64(len(data)), name, limits)
+}
+
+// ReadFileAt extracts a regular file from an archive of the given size by its
+// cleaned path
+func ReadFileAt(r io.ReaderAt, size int64, name string, limits Limits) ([]byte, error) {
+	name, ok := CleanPath(name)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	switch formatAt(r) {
+	case "zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip: %w", err)
+		}
+		for _, f := range zr.File {
+			if clean, ok := CleanPath(f.Name); !ok || clean != name || !f.Mode().IsRegular() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("failed to open zip member: %w", err)
+			}
+			defer rc.Close()
+			return readLimited(rc, limits.MaxEntrySize)
+		}
+
+	case "tar", "tar.gz":
+		tr, err := tarReader(r, size, limits)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tar: %w", err)
+			}
+			if clean, ok := CleanPath(hdr.Name); !ok || clean != name || hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			return readLimited(tr, limits.MaxEntrySize)
+		}
+
+	default:
+		return nil, ErrUnsupported
+	}
+
+	return nil, ErrNotFound
+}
+
+// tarReader opens a plain or gzip-compressed tar stream. Decompressed bytes
+// are counted against MaxTotalSize since skipping members still inflates them.
+func tarReader(ra io.ReaderAt, size int64, limits Limits) (*tar.Reader, error) {
+	var r io.Reader = io.NewSectionReader(ra, 0, size)
+	if formatAt(ra) == "tar.gz" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip: %w", err)
+		}
+		r = gz
+	}
+	if limits.MaxTotalSize > 0 {
+		r = &limitedReader{r: r, left: limits.MaxTotalSize}
+	}
+	return tar.NewReader(r), nil
+}
+
+// readLimited reads all of r, failing with ErrTooLarge past max bytes
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// limitedReader is like io.LimitReader but fails with ErrTooLarge instead of
+// reporting a clean EOF once the limit is reached
+type limitedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.left <= 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.left {
+		p = p[:l.left]
+	}
+	n, err := l.r.Read(p)
+	l.left -= int64(n)
+	return n, err
+}
@@ -0,0 +1,162 @@
+// Package cache keeps rendered pages so popular shares are not fetched from
+// storage and rendered again on every view.
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// Cache is an in-memory LRU of rendered pages bounded by their total size.
+// The default page of an item can also be kept as a derived object in
+// storage, where it survives restarts and is shared between server instances.
+// Other pages, like sorted tables or other themes, vary with the viewer's
+// query and are only kept in memory.
+type Cache struct {
+	mu      sync.Mutex
+	budget  int64 // bytes of pages kept in memory, 0 to keep none
+	size    int64
+	order   *list.List // of *entry, most recently used first
+	entries map[string]*list.Element
+
+	store storage.Storage // nil unless pages are kept in storage
+}
+
+type entry struct {
+	id   string
+	key  string
+	page []byte
+}
+
+// New creates a cache keeping up to budget bytes of pages in memory, and
+// every page in store if it is not nil
+func New(budget int64, store storage.Storage) *Cache {
+	return &Cache{
+		budget:  budget,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		store:   store,
+	}
+}
+
+// Key identifies a rendering of an item: its ID, the hash of its content,
+// the renderer version and anything else the page depends on
+func Key(id string, contentHash string, version string, variant ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{id, contentHash, version}, variant...), "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// pageName is the derived artifact holding the stored page of an item,
+// preceded by its key on a line of its own
+const pageName = "page.html"
+
+// Get returns a cached page, looking in storage if it is not in memory and
+// stored is set
+func (c *Cache) Get(ctx context.Context, id string, key string, stored bool) ([]byte, bool) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		page := el.Value.(*entry).page
+		c.mu.Unlock()
+		return page, true
+	}
+	c.mu.Unlock()
+
+	if c.store == nil || !stored {
+		return nil, false
+	}
+	derived, err := c.store.GetDerived(ctx, id, pageName)
+	if err != nil {
+		return nil, false
+	}
+	defer derived.Close()
+
+	data, err := io.ReadAll(derived)
+	if err != nil {
+		return nil, false
+	}
+	// A page stored for other content or settings is stale
+	storedKey, page, ok := bytes.Cut(data, []byte("\n"))
+	if !ok || string(storedKey) != key {
+		return nil, false
+	}
+	c.Put(id, key, page)
+	return page, true
+}
+
+// Persist keeps the default page of an item in storage, if enabled,
+// replacing the one stored before. It is slower than Put, so best done in
+// the background.
+func (c *Cache) Persist(ctx context.Context, id string, key string, page []byte) error {
+	if c.store == nil {
+		return nil
+	}
+	data := append([]byte(key+"\n"), page...)
+	return c.store.PutDerived(ctx, id, pageName, bytes.NewReader(data))
+}
+
+// Drop removes the stored page of an item whose content or settings changed
+func (c *Cache) Drop(ctx context.Context, id string) error {
+	if c.store == nil {
+		return nil
+	}
+	return c.store.DeleteDerived(ctx, id, pageName)
+}
+
+// Persistent reports whether pages are kept in storage
+func (c *Cache) Persistent() bool {
+	return c.store != nil
+}
+
+// Put keeps a page in memory, evicting the least recently used ones to stay
+// within the budget. Pages taking up more than a quarter of it are skipped.
+func (c *Cache) Put(id string, key string, page []byte) {
+	size := int64(len(page))
+	if size > c.budget/4 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{id: id, key: key, page: page})
+	c.size += size
+
+	for c.size > c.budget {
+		c.remove(c.order.Back())
+	}
+}
+
+// Invalidate drops the pages of an item from memory. The stored page is
+// removed with Drop, and is not served once its content changes since the
+// key includes the content hash.
+func (c *Cache) Invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*entry).id == id {
+			c.remove(el)
+		}
+		el = next
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.page))
+}
@@ -11,12 +11,19 @@ import (
 
 // Config holds the server configuration
 type Config struct {
-	Domain     string        `yaml:"domain"`
-	BaseURL    string        `yaml:"base_url"`
-	ListenAddr string        `yaml:"listen_addr"`
-	Storage    StorageConfig `yaml:"storage"`
-	Limits     LimitsConfig  `yaml:"limits"`
-	Auth       AuthConfig    `yaml:"auth"`
+	Domain      string            `yaml:"domain"`
+	BaseURL     string            `yaml:"base_url"`
+	ListenAddr  string            `yaml:"listen_addr"`
+	Storage     StorageConfig     `yaml:"storage"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Auth        AuthConfig        `yaml:"auth"`
+	WebDAV      WebDAVConfig      `yaml:"webdav"`
+	Render      RenderConfig      `yaml:"render"`
+	Uploads     UploadsConfig     `yaml:"uploads"`
+	Revisions   RevisionsConfig   `yaml:"revisions"`
+	Previews    PreviewsConfig    `yaml:"previews"`
+	Archives    ArchivesConfig    `yaml:"archives"`
+	UserContent UserContentConfig `yaml:"usercontent"`
 }
 
 // StorageConfig holds S3-compatible storage configuration
@@ -33,9 +40,9 @@ type StorageConfig struct {
 
 // LimitsConfig holds rate limiting and size limits
 type LimitsConfig struct {
-	MaxFileSize  string `yaml:"max_file_size"`  // e.g., "100MB", "1GB", "0" for unlimited
-	RateLimit    string `yaml:"rate_limit"`     // e.g., "10/minute", "0" for unlimited
-	StorageQuota string `yaml:"storage_quota"`  // per-user quota
+	MaxFileSize  string `yaml:"max_file_size"` // e.g., "100MB", "1GB", "0" for unlimited
+	RateLimit    string `yaml:"rate_limit"`    // e.g., "10/minute", "0" for unlimited
+	StorageQuota string `yaml:"storage_quota"` // per-user quota
 }
 
 // AuthConfig holds authentication configuration
@@ -44,6 +51,57 @@ type AuthConfig struct {
 	TokenFile string   `yaml:"token_file"` // path to file containing tokens (one per line)
 }
 
+// WebDAVConfig holds WebDAV configuration
+type WebDAVConfig struct {
+	LockSystem  string `yaml:"lock_system"`  // "memory" or "storage"
+	LockTimeout string `yaml:"lock_timeout"` // max lifetime of locks requested with an infinite timeout, e.g. "24h"
+}
+
+// RenderConfig holds settings for rendered views
+type RenderConfig struct {
+	HighlightMaxSize string `yaml:"highlight_max_size"` // e.g., "1MB"; larger code is shown as plain text, "0" for unlimited
+	MaxSize          string `yaml:"max_size"`           // e.g., "10MB"; larger text shows its first lines, other files are served raw, "0" for unlimited
+	PreviewLines     int    `yaml:"preview_lines"`      // lines shown of text larger than max_size
+	Diagrams         bool   `yaml:"diagrams"`           // draw mermaid and dot code blocks in Markdown
+	Math             bool   `yaml:"math"`               // typeset $...$ and $$...$$ in Markdown with KaTeX
+	Theme            string `yaml:"theme"`              // "dark", "light" or "auto" to follow the viewer's system setting
+	BrandingDir      string `yaml:"branding_dir"`       // directory with custom.css and a logo.svg/png added to every page
+	CacheSize        string `yaml:"cache_size"`         // e.g., "64MB"; memory for rendered pages, "0" to disable
+	CacheStorage     bool   `yaml:"cache_storage"`      // also keep rendered pages in storage, next to thumbnails
+}
+
+// UploadsConfig holds defaults applied to uploaded content
+type UploadsConfig struct {
+	StripMetadata   bool   `yaml:"strip_metadata"`   // remove EXIF/GPS metadata from JPEG, PNG and WebP images
+	ResumableExpiry string `yaml:"resumable_expiry"` // e.g. "24h"; unfinished resumable uploads are removed after this
+}
+
+// RevisionsConfig holds how previous versions of replaced shares are kept
+type RevisionsConfig struct {
+	Keep int `yaml:"keep"` // previous versions kept per share, -1 for none
+}
+
+// PreviewsConfig holds thumbnail generation settings
+type PreviewsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Size    int    `yaml:"size"`    // max thumbnail width and height in pixels
+	Workers int    `yaml:"workers"` // number of background jobs run concurrently
+	FFmpeg  string `yaml:"ffmpeg"`  // path to ffmpeg for video poster frames, empty to look it up in PATH
+}
+
+// ArchivesConfig holds limits for browsing zip and tar files
+type ArchivesConfig struct {
+	MaxSize      string `yaml:"max_size"`       // largest archive whose files can be viewed or hosted
+	MaxEntries   int    `yaml:"max_entries"`    // entries listed per archive
+	MaxEntrySize string `yaml:"max_entry_size"` // largest member that can be viewed, uncompressed
+	MaxTotalSize string `yaml:"max_total_size"` // uncompressed bytes read from a tar.gz
+}
+
+// UserContentConfig holds settings for hosting HTML shares on a separate domain
+type UserContentConfig struct {
+	BaseURL string `yaml:"base_url"` // e.g. https://usercontent.example.net, empty to disable
+}
+
 // Load reads configuration from file
 func Load() (*Config, error) {
 	configPath := os.Getenv("SHARE_CONFIG")
@@ -82,6 +140,34 @@ func defaultConfig() *Config {
 			RateLimit:    "0",
 			StorageQuota: "0",
 		},
+		WebDAV: WebDAVConfig{
+			LockSystem:  "memory",
+			LockTimeout: "24h",
+		},
+		Render: RenderConfig{
+			HighlightMaxSize: "1MB",
+			MaxSize:          "10MB",
+			PreviewLines:     1000,
+			Theme:            "dark",
+			CacheSize:        "64MB",
+		},
+		Uploads: UploadsConfig{
+			ResumableExpiry: "24h",
+		},
+		Revisions: RevisionsConfig{
+			Keep: 10,
+		},
+		Previews: PreviewsConfig{
+			Enabled: true,
+			Size:    320,
+			Workers: 2,
+		},
+		Archives: ArchivesConfig{
+			MaxSize:      "1GB",
+			MaxEntries:   10000,
+			MaxEntrySize: "50MB",
+			MaxTotalSize: "1GB",
+		},
 	}
 }
 
@@ -98,6 +184,51 @@ func (c *Config) applyDefaults() {
 	if c.Limits.MaxFileSize == "" {
 		c.Limits.MaxFileSize = "0"
 	}
+	if c.WebDAV.LockSystem == "" {
+		c.WebDAV.LockSystem = "memory"
+	}
+	if c.WebDAV.LockTimeout == "" {
+		c.WebDAV.LockTimeout = "24h"
+	}
+	if c.Render.HighlightMaxSize == "" {
+		c.Render.HighlightMaxSize = "1MB"
+	}
+	if c.Render.MaxSize == "" {
+		c.Render.MaxSize = "10MB"
+	}
+	if c.Render.PreviewLines <= 0 {
+		c.Render.PreviewLines = 1000
+	}
+	if c.Render.Theme == "" {
+		c.Render.Theme = "dark"
+	}
+	if c.Render.CacheSize == "" {
+		c.Render.CacheSize = "64MB"
+	}
+	if c.Uploads.ResumableExpiry == "" {
+		c.Uploads.ResumableExpiry = "24h"
+	}
+	if c.Revisions.Keep == 0 {
+		c.Revisions.Keep = 10
+	}
+	if c.Previews.Size <= 0 {
+		c.Previews.Size = 320
+	}
+	if c.Previews.Workers <= 0 {
+		c.Previews.Workers = 2
+	}
+	if c.Archives.MaxSize == "" {
+		c.Archives.MaxSize = "1GB"
+	}
+	if c.Archives.MaxEntries <= 0 {
+		c.Archives.MaxEntries = 10000
+	}
+	if c.Archives.MaxEntrySize == "" {
+		c.Archives.MaxEntrySize = "50MB"
+	}
+	if c.Archives.MaxTotalSize == "" {
+		c.Archives.MaxTotalSize = "1GB"
+	}
 
 	// Load tokens from file if specified
 	if c.Auth.TokenFile != "" {
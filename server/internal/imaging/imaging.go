@@ -0,0 +1,23 @@
+// Package imaging inspects and processes uploaded images.
+package imaging
+
+import (
+	"bytes"
+	"image"
+
+	// Decoders for the formats shared from phones and screenshots
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Dimensions returns the pixel size of an image without decoding the pixel data
+func Dimensions(data []byte) (width, height int, ok bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
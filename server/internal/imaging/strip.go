@@ -0,0 +1,252 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// ErrMalformed is returned when an image cannot be parsed for stripping
+var ErrMalformed = errors.New("malformed image")
+
+// CanStrip reports whether metadata can be stripped from the content type
+func CanStrip(contentType string) bool {
+	switch baseType(contentType) {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// StripMetadata removes EXIF, XMP and textual metadata (camera details, GPS
+// location, timestamps) from JPEG, PNG and WebP images without re-encoding.
+// The JPEG orientation tag is kept so photos still display upright.
+func StripMetadata(contentType string, data []byte) ([]byte, error) {
+	switch baseType(contentType) {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+func baseType(contentType string) string {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	return strings.TrimSpace(ct)
+}
+
+// --- JPEG ---
+
+const (
+	jpegSOI  = 0xd8
+	jpegSOS  = 0xda
+	jpegAPP1 = 0xe1
+	jpegAPPD = 0xed // Photoshop IRB / IPTC
+	jpegCOM  = 0xfe
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != jpegSOI {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	pos := 2
+
+	for pos < len(data) {
+		if data[pos] != 0xff || pos+1 >= len(data) {
+			return nil, ErrMalformed
+		}
+		marker := data[pos+1]
+
+		// Fill bytes and markers without a length field
+		if marker == 0xff {
+			pos++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			out.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil, ErrMalformed
+		}
+		segment := data[pos:end]
+		payload := data[pos+4 : end]
+
+		switch marker {
+		case jpegSOS:
+			// Entropy-coded data follows, no more metadata segments
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		case jpegAPP1:
+			if bytes.HasPrefix(payload, exifHeader) {
+				if orientation := exifOrientation(payload[len(exifHeader):]); orientation > 1 {
+					out.Write(orientationSegment(orientation))
+				}
+			}
+		case jpegAPPD, jpegCOM:
+			// dropped
+		default:
+			out.Write(segment)
+		}
+		pos = end
+	}
+
+	return nil, ErrMalformed
+}
+
+// exifOrientation returns the orientation tag from a TIFF structure, or 0
+func exifOrientation(tiff []byte) uint16 {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return order.Uint16(tiff[entry+8:])
+		}
+	}
+	return 0
+}
+
+// orientationSegment builds a minimal EXIF APP1 segment holding only the orientation tag
+func orientationSegment(orientation uint16) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0xff, jpegAPP1, 0, 0}) // length filled in below
+	b.Write(exifHeader)
+	b.Write([]byte("MM\x00\x2a\x00\x00\x00\x08")) // big-endian TIFF header, IFD0 at offset 8
+	binary.Write(&b, binary.BigEndian, uint16(1)) // one entry
+	binary.Write(&b, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&b, binary.BigEndian, uint32(1))
+	binary.Write(&b, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&b, binary.BigEndian, uint32(0)) // no next IFD
+
+	segment := b.Bytes()
+	binary.BigEndian.PutUint16(segment[2:4], uint16(len(segment)-2))
+	return segment
+}
+
+// --- PNG ---
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are ancillary chunks that carry metadata rather than pixels
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	pos := len(pngSignature)
+
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length // length, type, data, CRC
+		if end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+
+		if chunkType == "IEND" {
+			return out.Bytes(), nil
+		}
+	}
+
+	return nil, ErrMalformed
+}
+
+// --- WebP ---
+
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+
+	var chunks bytes.Buffer
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size%2 // chunks are padded to even length
+		if end > len(data) {
+			return nil, ErrMalformed
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+			// dropped
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			chunks.Write(chunk)
+		default:
+			chunks.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	out := make([]byte, 12, 12+chunks.Len())
+	copy(out, data[:12])
+	binary.LittleEndian.PutUint32(out[4:8], uint32(4+chunks.Len()))
+	return append(out, chunks.Bytes()...), nil
+}
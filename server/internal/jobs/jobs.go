@@ -0,0 +1,76 @@
+// Package jobs runs work in the background, outside of request handling.
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// jobTimeout bounds how long a single job may run
+const jobTimeout = 5 * time.Minute
+
+type job struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Queue runs submitted jobs on a fixed pool of workers
+type Queue struct {
+	jobs chan job
+	wg   sync.WaitGroup
+}
+
+// NewQueue starts a queue with the given number of workers and pending job capacity
+func NewQueue(workers int, capacity int) *Queue {
+	q := &Queue{jobs: make(chan job, capacity)}
+
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	return q
+}
+
+// Submit schedules a job without blocking. It returns false if the queue is full.
+func (q *Queue) Submit(name string, fn func(ctx context.Context) error) bool {
+	select {
+	case q.jobs <- job{name: name, fn: fn}:
+		return true
+	default:
+		log.Printf("Job queue full, dropping %s", name)
+		return false
+	}
+}
+
+// Close stops accepting jobs and waits for pending ones to finish
+func (q *Queue) Close() {
+	close(q.jobs)
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for j := range q.jobs {
+		q.run(j)
+	}
+}
+
+func (q *Queue) run(j job) {
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	// A failing job must not take the worker down with it
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", j.name, r)
+		}
+	}()
+
+	if err := j.fn(ctx); err != nil {
+		log.Printf("Job %s failed: %v", j.name, err)
+	}
+}
@@ -0,0 +1,48 @@
+package preview
+
+import (
+	"bytes"
+	"regexp"
+)
+
+var (
+	pdfStream    = regexp.MustCompile(`stream\r?\n`)
+	pdfObjStart  = regexp.MustCompile(`\d+\s+\d+\s+obj\b`)
+	pdfImageDict = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	pdfDCTFilter = regexp.MustCompile(`/DCTDecode\b`)
+)
+
+// pdfImage returns the first JPEG image embedded in a PDF. Scanned documents
+// and slide decks typically start with one, which makes a good cover image.
+// Vector-only documents have none and get no thumbnail.
+func pdfImage(data []byte) ([]byte, error) {
+	for _, loc := range pdfStream.FindAllIndex(data, -1) {
+		// The stream keyword must follow the object's dictionary
+		start, end := loc[0], loc[1]
+		if !bytes.HasSuffix(bytes.TrimRight(data[:start], " \t\r\n"), []byte(">>")) {
+			continue
+		}
+
+		objs := pdfObjStart.FindAllIndex(data[max(0, start-4096):start], -1)
+		if len(objs) == 0 {
+			continue
+		}
+		dict := data[max(0, start-4096)+objs[len(objs)-1][1] : start]
+		if !pdfImageDict.Match(dict) || !pdfDCTFilter.Match(dict) {
+			continue
+		}
+
+		// JPEG data runs until endstream, its end marker makes trailing
+		// whitespace harmless
+		stop := bytes.Index(data[end:], []byte("endstream"))
+		if stop < 0 {
+			continue
+		}
+		jpeg := data[end : end+stop]
+		if len(jpeg) > 2 && jpeg[0] == 0xff && jpeg[1] == 0xd8 {
+			return jpeg, nil
+		}
+	}
+
+	return nil, ErrUnsupported
+}
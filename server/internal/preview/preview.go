@@ -0,0 +1,122 @@
+// Package preview generates thumbnails for uploaded items.
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/config"
+	"github.com/Fileri/share/server/internal/imaging"
+	"github.com/Fileri/share/server/internal/storage"
+)
+
+// ThumbnailName is the name under which thumbnails are stored as derived artifacts
+const ThumbnailName = "thumb.jpg"
+
+// maxSourceSize bounds the size of items thumbnails are generated for
+const maxSourceSize = 100 * 1024 * 1024
+
+// ErrUnsupported is returned when no thumbnail can be made for an item
+var ErrUnsupported = errors.New("no thumbnail available")
+
+// Generator creates thumbnails and stores them alongside the item
+type Generator struct {
+	store  storage.Storage
+	size   int
+	ffmpeg string // empty if video thumbnails are unavailable
+}
+
+// New creates a thumbnail generator
+func New(cfg config.PreviewsConfig, store storage.Storage) *Generator {
+	ffmpeg := cfg.FFmpeg
+	if ffmpeg == "" {
+		if path, err := exec.LookPath("ffmpeg"); err == nil {
+			ffmpeg = path
+		}
+	}
+	if ffmpeg == "" {
+		log.Printf("ffmpeg not found, video thumbnails disabled")
+	}
+
+	return &Generator{
+		store:  store,
+		size:   cfg.Size,
+		ffmpeg: ffmpeg,
+	}
+}
+
+// CanGenerate reports whether a thumbnail can be made for the content type
+func (g *Generator) CanGenerate(contentType string) bool {
+	ct := strings.ToLower(contentType)
+
+	switch {
+	case strings.HasPrefix(ct, "image/"):
+		return true
+	case strings.HasPrefix(ct, "application/pdf"):
+		return true
+	case strings.HasPrefix(ct, "video/"):
+		return g.ffmpeg != ""
+	}
+	return false
+}
+
+// Generate creates and stores the thumbnail for an item
+func (g *Generator) Generate(ctx context.Context, id string) error {
+	content, item, err := g.store.Get(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+	defer content.Close()
+
+	if !g.CanGenerate(item.ContentType) {
+		return nil
+	}
+	if item.Size > maxSourceSize {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(content, maxSourceSize))
+	if err != nil {
+		return fmt.Errorf("failed to read item: %w", err)
+	}
+
+	// Reduce every format to an encoded image first
+	ct := strings.ToLower(item.ContentType)
+	switch {
+	case strings.HasPrefix(ct, "application/pdf"):
+		data, err = pdfImage(data)
+	case strings.HasPrefix(ct, "video/"):
+		data, err = videoFrame(ctx, g.ffmpeg, data)
+	}
+	if errors.Is(err, ErrUnsupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	thumb, err := imaging.Thumbnail(data, g.size)
+	if errors.Is(err, image.ErrFormat) || errors.Is(err, imaging.ErrTooLarge) {
+		return nil // e.g. SVG, nothing we can decode
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := imaging.EncodeJPEG(&buf, thumb); err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	if err := g.store.PutDerived(ctx, id, ThumbnailName, &buf); err != nil {
+		return fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return nil
+}
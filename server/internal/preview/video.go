@@ -0,0 +1,45 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// videoFrame extracts a poster frame from a video as JPEG using ffmpeg
+func videoFrame(ctx context.Context, ffmpeg string, data []byte) ([]byte, error) {
+	// ffmpeg needs a seekable input for most containers
+	tmp, err := os.CreateTemp("", "share-video-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	var out, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpeg,
+		"-hide_banner", "-loglevel", "error",
+		"-ss", "1", "-i", tmp.Name(),
+		"-frames:v", "1", "-f", "image2", "-c:v", "mjpeg", "pipe:1",
+	)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	// Videos shorter than the seek offset produce no frame
+	if out.Len() == 0 {
+		return nil, ErrUnsupported
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,371 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ansiPalette holds the 16 basic terminal colors, the remaining 240 of the
+// xterm palette are computed
+var ansiPalette = [16]string{
+	"#484f58", "#ff7b72", "#3fb950", "#d29922", "#58a6ff", "#bc8cff", "#39c5cf", "#b1bac4",
+	"#6e7681", "#ffa198", "#56d364", "#e3b341", "#79c0ff", "#d2a8ff", "#56d4dd", "#ffffff",
+}
+
+// ansiLightPalette replaces the basic colors in the light theme, where the
+// bright variants of the dark palette are hard to read
+var ansiLightPalette = [16]string{
+	"#24292f", "#cf222e", "#116329", "#4d2d00", "#0969da", "#8250df", "#1b7c83", "#6e7781",
+	"#57606a", "#a40e26", "#1a7f37", "#633c01", "#218bff", "#a475f9", "#3192aa", "#8c959f",
+}
+
+// ansiLevels are the channel values of the xterm 6x6x6 color cube
+var ansiLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+// ansiColor returns the CSS color of an xterm palette index
+func ansiColor(n int) string {
+	switch {
+	case n < 16:
+		return ansiPalette[n]
+	case n < 232:
+		n -= 16
+		return fmt.Sprintf("#%02x%02x%02x", ansiLevels[n/36], ansiLevels[n/6%6], ansiLevels[n%6])
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
+
+// ansiCSS is the stylesheet for the classes produced from SGR escapes. Colors
+// are classes rather than inline styles since the CSP blocks those.
+var ansiCSS = func() string {
+	var b strings.Builder
+	b.WriteString("/* Terminal colors, generated at startup */\n")
+	for n := 0; n < 256; n++ {
+		fmt.Fprintf(&b, ".ansi-fg-%d { color: %s; }\n", n, ansiColor(n))
+	}
+	for n := 0; n < 256; n++ {
+		fmt.Fprintf(&b, ".ansi-bg-%d { background-color: %s; }\n", n, ansiColor(n))
+	}
+	b.WriteString(`.ansi-bold { font-weight: bold; }
+.ansi-dim { opacity: 0.7; }
+.ansi-italic { font-style: italic; }
+.ansi-underline { text-decoration: underline; }
+.ansi-strike { text-decoration: line-through; }
+.ansi-underline.ansi-strike { text-decoration: underline line-through; }
+.ansi-inverse { color: var(--bg); background-color: var(--fg); }
+`)
+	var light strings.Builder
+	for n, color := range ansiLightPalette {
+		fmt.Fprintf(&light, ".ansi-fg-%d { color: %s; }\n", n, color)
+	}
+	for n, color := range ansiLightPalette {
+		fmt.Fprintf(&light, ".ansi-bg-%d { background-color: %s; }\n", n, color)
+	}
+	b.WriteString(forTheme(light.String(), ThemeLight))
+	return b.String()
+}()
+
+// ansiStyle is the graphic rendition state set by SGR escapes
+type ansiStyle struct {
+	fg, bg    int // palette index, -1 for the default color
+	bold, dim bool
+	italic    bool
+	underline bool
+	strike    bool
+	inverse   bool
+}
+
+var defaultANSIStyle = ansiStyle{fg: -1, bg: -1}
+
+// class returns the CSS classes for the style, empty for the default
+func (s ansiStyle) class() string {
+	fg, bg := s.fg, s.bg
+	var classes []string
+	if s.inverse {
+		if fg < 0 && bg < 0 {
+			classes = append(classes, "ansi-inverse")
+		}
+		fg, bg = bg, fg
+	}
+	if fg >= 0 {
+		classes = append(classes, "ansi-fg-"+strconv.Itoa(fg))
+	}
+	if bg >= 0 {
+		classes = append(classes, "ansi-bg-"+strconv.Itoa(bg))
+	}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{{s.bold, "ansi-bold"}, {s.dim, "ansi-dim"}, {s.italic, "ansi-italic"}, {s.underline, "ansi-underline"}, {s.strike, "ansi-strike"}} {
+		if flag.set {
+			classes = append(classes, flag.name)
+		}
+	}
+	return strings.Join(classes, " ")
+}
+
+// apply updates the style from the parameters of an SGR escape
+func (s *ansiStyle) apply(params []int) {
+	if len(params) == 0 {
+		params = []int{0}
+	}
+	for i := 0; i < len(params); i++ {
+		switch p := params[i]; {
+		case p == 0:
+			*s = defaultANSIStyle
+		case p == 1:
+			s.bold = true
+		case p == 2:
+			s.dim = true
+		case p == 3:
+			s.italic = true
+		case p == 4:
+			s.underline = true
+		case p == 7:
+			s.inverse = true
+		case p == 9:
+			s.strike = true
+		case p == 21 || p == 22:
+			s.bold, s.dim = false, false
+		case p == 23:
+			s.italic = false
+		case p == 24:
+			s.underline = false
+		case p == 27:
+			s.inverse = false
+		case p == 29:
+			s.strike = false
+		case p >= 30 && p <= 37:
+			s.fg = p - 30
+		case p == 39:
+			s.fg = -1
+		case p >= 40 && p <= 47:
+			s.bg = p - 40
+		case p == 49:
+			s.bg = -1
+		case p >= 90 && p <= 97:
+			s.fg = p - 90 + 8
+		case p >= 100 && p <= 107:
+			s.bg = p - 100 + 8
+		case p == 38 || p == 48:
+			color, n := extendedColor(params[i+1:])
+			i += n
+			if color < 0 {
+				continue
+			}
+			if p == 38 {
+				s.fg = color
+			} else {
+				s.bg = color
+			}
+		}
+	}
+}
+
+// extendedColor parses the 5;n and 2;r;g;b forms following 38 or 48, returning
+// the palette index, or -1, and the number of parameters consumed. True colors
+// are mapped to the nearest palette entry.
+func extendedColor(params []int) (int, int) {
+	if len(params) >= 2 && params[0] == 5 {
+		return min(max(params[1], 0), 255), 2
+	}
+	if len(params) >= 4 && params[0] == 2 {
+		r, g, b := params[1], params[2], params[3]
+		if r == g && g == b && r > 4 && r < 247 {
+			return 232 + min((r-8+5)/10, 23), 4
+		}
+		return 16 + 36*nearestLevel(r) + 6*nearestLevel(g) + nearestLevel(b), 4
+	}
+	return -1, len(params)
+}
+
+func nearestLevel(v int) int {
+	best := 0
+	for i, level := range ansiLevels {
+		if abs(v-level) < abs(v-ansiLevels[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// ansiRun is text printed in one style
+type ansiRun struct {
+	style ansiStyle
+	text  string
+}
+
+// hasANSI reports whether content contains terminal escape sequences
+func hasANSI(content []byte) bool {
+	return bytes.Contains(content, []byte("\x1b["))
+}
+
+// parseANSI splits terminal output into lines of styled runs
+func parseANSI(text string) [][]ansiRun {
+	p := newANSIParser()
+	var lines [][]ansiRun
+	for _, line := range strings.SplitAfter(text, "\n") {
+		runs := p.line(strings.TrimSuffix(line, "\n"))
+		// A last line without a newline is kept only if it shows something
+		if strings.HasSuffix(line, "\n") || len(runs) > 0 {
+			lines = append(lines, runs)
+		}
+	}
+	return lines
+}
+
+// ansiParser reads terminal output line by line, carrying the style set by
+// escapes over to the following lines
+type ansiParser struct {
+	style ansiStyle
+}
+
+func newANSIParser() *ansiParser {
+	return &ansiParser{style: defaultANSIStyle}
+}
+
+// line parses a line of output without its newline. Color escapes are kept,
+// other control sequences are dropped, and a carriage return starts the line
+// over as progress bars expect.
+func (p *ansiParser) line(text string) []ansiRun {
+	var line []ansiRun
+	var buf strings.Builder
+
+	flush := func() {
+		if buf.Len() > 0 {
+			line = append(line, ansiRun{style: p.style, text: buf.String()})
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\r':
+			if i+1 == len(text) {
+				continue // CRLF line ending
+			}
+			buf.Reset()
+			line = nil
+
+		case c == '\x1b':
+			n, params, final := parseEscape(text[i:])
+			if final == 'm' {
+				flush()
+				p.style.apply(params)
+			}
+			i += n - 1
+
+		case c == '\t' || c >= 0x20 && c != 0x7f:
+			buf.WriteByte(c)
+		}
+	}
+
+	flush()
+	return line
+}
+
+// parseEscape reads the escape sequence at the start of s, returning its
+// length and, for CSI sequences, the numeric parameters and final byte
+func parseEscape(s string) (int, []int, byte) {
+	if len(s) < 2 {
+		return len(s), nil, 0
+	}
+
+	switch s[1] {
+	case '[': // CSI: parameters and intermediates, then a final byte
+		end := 2
+		for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+			end++
+		}
+		if end == len(s) {
+			return len(s), nil, 0
+		}
+		var params []int
+		if body := s[2:end]; body != "" && body[0] >= '0' && body[0] <= ';' {
+			for _, p := range strings.FieldsFunc(body, func(r rune) bool { return r == ';' || r == ':' }) {
+				n, _ := strconv.Atoi(p)
+				params = append(params, n)
+			}
+		}
+		return end + 1, params, s[end]
+
+	case ']', 'P', '_', '^': // strings ended by BEL or ST, e.g. window titles and links
+		for end := 2; end < len(s); end++ {
+			if s[end] == '\a' {
+				return end + 1, nil, 0
+			}
+			if s[end] == '\x1b' && end+1 < len(s) && s[end+1] == '\\' {
+				return end + 2, nil, 0
+			}
+		}
+		return len(s), nil, 0
+
+	case '(', ')', '*', '+': // character set selection
+		return min(3, len(s)), nil, 0
+	}
+	return 2, nil, 0
+}
+
+// writeANSIRuns writes runs as HTML spans with the style's classes
+func writeANSIRuns(w io.Writer, runs []ansiRun) {
+	for _, run := range runs {
+		if class := run.style.class(); class != "" {
+			fmt.Fprintf(w, `<span class="%s">%s</span>`, class, html.EscapeString(run.text))
+		} else {
+			io.WriteString(w, html.EscapeString(run.text))
+		}
+	}
+}
+
+// writeLineStart opens line n in the markup of the code view, with its number
+// padded to digits
+func writeLineStart(w io.Writer, n int, digits int) {
+	fmt.Fprintf(w, `<span class="line"><span class="ln" id="L%d"><a class="lnlinks" href="#L%d">%*d</a></span><span class="cl">`, n, n, digits, n)
+}
+
+// lineEnd closes a line opened with writeLineStart
+const lineEnd = "\n</span></span>"
+
+// ansiToHTML renders terminal output as lines in the markup of the code view,
+// so line links work the same
+func ansiToHTML(text string) string {
+	lines := parseANSI(text)
+	digits := len(strconv.Itoa(len(lines)))
+
+	var b strings.Builder
+	b.WriteString(`<pre tabindex="0" class="chroma"><code>`)
+	for i, line := range lines {
+		writeLineStart(&b, i+1, digits)
+		writeANSIRuns(&b, line)
+		b.WriteString(lineEnd)
+	}
+	b.WriteString(`</code></pre>`)
+	return b.String()
+}
+
+func renderLog(content []byte, filename string, rawURL string) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	result := strings.ReplaceAll(logPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	// Content last so placeholders inside the log are left alone
+	result = strings.Replace(result, "{{CONTENT}}", ansiToHTML(string(content)), 1)
+
+	return []byte(result), nil
+}
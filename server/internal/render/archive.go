@@ -0,0 +1,126 @@
+package render
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Fileri/share/server/internal/archive"
+)
+
+// archiveNode is a file or directory in the tree built from an archive listing
+type archiveNode struct {
+	name     string
+	entry    *archive.Entry // nil for directories without their own entry
+	children map[string]*archiveNode
+}
+
+func (n *archiveNode) child(name string) *archiveNode {
+	if c, ok := n.children[name]; ok {
+		return c
+	}
+	c := &archiveNode{name: name, children: map[string]*archiveNode{}}
+	n.children[name] = c
+	return c
+}
+
+// sortedChildren lists directories first, then files, each by name
+func (n *archiveNode) sortedChildren() []*archiveNode {
+	children := make([]*archiveNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if a, b := children[i].isDir(), children[j].isDir(); a != b {
+			return a
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+func (n *archiveNode) isDir() bool {
+	return len(n.children) > 0 || (n.entry != nil && n.entry.Dir)
+}
+
+func renderArchive(content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	listing, err := archive.List(content, opts.ArchiveLimits)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories are implied by member paths, not all archives list them
+	root := &archiveNode{children: map[string]*archiveNode{}}
+	files, total := 0, int64(0)
+	for i := range listing.Entries {
+		e := &listing.Entries[i]
+		node := root
+		for _, part := range strings.Split(e.Path, "/") {
+			node = node.child(part)
+		}
+		node.entry = e
+		if !e.Dir {
+			files++
+			total += e.Size
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<ul class="tree">`)
+	writeArchiveTree(&b, root, "", opts.FileURL, 0)
+	b.WriteString(`</ul>`)
+
+	summary := fmt.Sprintf("%d files, %s uncompressed", files, humanSize(total))
+	if listing.Truncated {
+		summary += " · listing truncated at the server's limit"
+	}
+	if listing.Skipped > 0 {
+		summary += fmt.Sprintf(" · %d unsafe or special entries skipped", listing.Skipped)
+	}
+
+	siteLink := ""
+	if _, ok := archive.SiteRoot(listing); ok && opts.SiteURL != "" {
+		siteLink = fmt.Sprintf(`<a href="%s">View as website</a>`, html.EscapeString(opts.SiteURL))
+	}
+
+	result := strings.ReplaceAll(archivePage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{SUMMARY}}", html.EscapeString(summary))
+	result = strings.ReplaceAll(result, "{{SITE_LINK}}", siteLink)
+	// Content last so placeholders inside entry names are left alone
+	result = strings.Replace(result, "{{CONTENT}}", b.String(), 1)
+
+	return []byte(result), nil
+}
+
+// writeArchiveTree writes the children of a node, top-level directories expanded
+func writeArchiveTree(b *strings.Builder, node *archiveNode, prefix string, fileURL string, depth int) {
+	for _, c := range node.sortedChildren() {
+		name := html.EscapeString(c.name)
+
+		if c.isDir() {
+			open := ""
+			if depth == 0 {
+				open = " open"
+			}
+			fmt.Fprintf(b, `<li class="dir"><details%s><summary>%s/</summary><ul>`, open, name)
+			writeArchiveTree(b, c, prefix+url.PathEscape(c.name)+"/", fileURL, depth+1)
+			b.WriteString(`</ul></details></li>`)
+			continue
+		}
+
+		modified := ""
+		if !c.entry.ModTime.IsZero() {
+			modified = c.entry.ModTime.UTC().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(b, `<li class="file"><a href="%s">%s</a><span class="size">%s</span><span class="mtime">%s</span></li>`,
+			html.EscapeString(fileURL+prefix+url.PathEscape(c.name)), name, humanSize(c.entry.Size), modified)
+	}
+}
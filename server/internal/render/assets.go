@@ -0,0 +1,129 @@
+package render
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
+	"path"
+	"regexp"
+)
+
+// AssetPrefix is the URL path under which static assets are served.
+// Asset URLs are /_assets/<version>/<name>, where version is a content hash.
+const AssetPrefix = "/_assets/"
+
+//go:embed assets
+var assetFS embed.FS
+
+// Asset is a static file used by the rendered views
+type Asset struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	Version     string // short content hash, changes whenever Data does
+	Integrity   string // Subresource Integrity hash
+}
+
+// URL returns the versioned path of the asset
+func (a *Asset) URL() string {
+	return AssetPrefix + a.Version + "/" + a.Name
+}
+
+// assets holds all embedded assets by name
+var assets = loadAssets()
+
+func loadAssets() map[string]*Asset {
+	result := make(map[string]*Asset)
+
+	entries, err := fs.ReadDir(assetFS, "assets")
+	if err != nil {
+		panic(fmt.Sprintf("render: failed to read embedded assets: %v", err))
+	}
+
+	for _, entry := range entries {
+		data, err := assetFS.ReadFile(path.Join("assets", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("render: failed to read asset %s: %v", entry.Name(), err))
+		}
+
+		// The code view builds on the highlighter's generated classes
+		if entry.Name() == "code.css" {
+			data = append([]byte(highlightCSS), data...)
+		}
+
+		result[entry.Name()] = newAsset(entry.Name(), data)
+	}
+
+	result["ansi.css"] = newAsset("ansi.css", []byte(ansiCSS))
+
+	// KaTeX's stylesheet loads fonts relative to itself, point it at their
+	// versioned URLs instead
+	if css, ok := result[katexStyleAsset]; ok {
+		data := katexFont.ReplaceAllFunc(css.Data, func(m []byte) []byte {
+			if font, ok := result[string(katexFont.FindSubmatch(m)[1])]; ok {
+				return []byte("url(" + font.URL() + ")")
+			}
+			return m
+		})
+		result[katexStyleAsset] = newAsset(katexStyleAsset, data)
+	}
+
+	return result
+}
+
+func newAsset(name string, data []byte) *Asset {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	version := sha256.Sum256(data)
+	integrity := sha512.Sum384(data)
+
+	return &Asset{
+		Name:        name,
+		ContentType: contentType,
+		Data:        data,
+		Version:     hex.EncodeToString(version[:6]),
+		Integrity:   "sha384-" + base64.StdEncoding.EncodeToString(integrity[:]),
+	}
+}
+
+// LookupAsset returns the embedded asset with the given name
+func LookupAsset(name string) (*Asset, bool) {
+	a, ok := assets[name]
+	return a, ok
+}
+
+// katexFont matches font URLs in KaTeX's stylesheet
+var katexFont = regexp.MustCompile(`url\(fonts/([\w-]+\.woff2)\)`)
+
+// assetPlaceholder matches {{STYLE name}} and {{SCRIPT name}} placeholders in templates
+var assetPlaceholder = regexp.MustCompile(`\{\{(STYLE|SCRIPT) ([\w.-]+)\}\}`)
+
+// withAssets replaces asset placeholders in a template with link and script
+// tags pointing at the versioned asset URLs
+func withAssets(tmpl string) string {
+	return assetPlaceholder.ReplaceAllStringFunc(tmpl, func(tag string) string {
+		m := assetPlaceholder.FindStringSubmatch(tag)
+		a, ok := assets[m[2]]
+		if !ok {
+			panic(fmt.Sprintf("render: template references unknown asset %s", m[2]))
+		}
+		return assetTag(a)
+	})
+}
+
+// assetTag returns the link or script tag that loads an asset
+func assetTag(a *Asset) string {
+	if path.Ext(a.Name) == ".css" {
+		return fmt.Sprintf(`<link rel="stylesheet" href="%s" integrity="%s">`, html.EscapeString(a.URL()), a.Integrity)
+	}
+	return fmt.Sprintf(`<script src="%s" integrity="%s"></script>`, html.EscapeString(a.URL()), a.Integrity)
+}
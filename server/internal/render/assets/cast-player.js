@@ -0,0 +1,407 @@
+// Play back an asciicast recording on a small terminal emulator. It handles
+// the escapes shells and common full-screen programs use: colors, cursor
+// movement, erasing, scroll regions and the alternate screen.
+(function () {
+    var data = JSON.parse(document.getElementById('cast-data').textContent);
+    var pre = document.getElementById('terminal');
+    var controls = document.getElementById('controls');
+    var playButton = document.getElementById('play');
+    var seek = document.getElementById('seek');
+    var timeLabel = document.getElementById('time');
+    var speedSelect = document.getElementById('speed');
+
+    var cols = data.width, rows = data.height;
+
+    // Graphic rendition, mirrors the classes generated by the server
+    function defaultStyle() {
+        return { fg: -1, bg: -1, bold: false, dim: false, italic: false, underline: false, strike: false, inverse: false };
+    }
+
+    function styleClass(s) {
+        var fg = s.fg, bg = s.bg, classes = [];
+        if (s.inverse) {
+            if (fg < 0 && bg < 0) classes.push('ansi-inverse');
+            var t = fg; fg = bg; bg = t;
+        }
+        if (fg >= 0) classes.push('ansi-fg-' + fg);
+        if (bg >= 0) classes.push('ansi-bg-' + bg);
+        if (s.bold) classes.push('ansi-bold');
+        if (s.dim) classes.push('ansi-dim');
+        if (s.italic) classes.push('ansi-italic');
+        if (s.underline) classes.push('ansi-underline');
+        if (s.strike) classes.push('ansi-strike');
+        return classes.join(' ');
+    }
+
+    var levels = [0, 95, 135, 175, 215, 255];
+
+    function nearestLevel(v) {
+        var best = 0;
+        for (var i = 1; i < levels.length; i++) {
+            if (Math.abs(v - levels[i]) < Math.abs(v - levels[best])) best = i;
+        }
+        return best;
+    }
+
+    // Returns [palette index or -1, parameters consumed] for 38/48 colors
+    function extendedColor(params, i) {
+        if (params[i] === 5 && i + 1 < params.length) {
+            return [Math.min(Math.max(params[i + 1], 0), 255), 2];
+        }
+        if (params[i] === 2 && i + 3 < params.length) {
+            var r = params[i + 1], g = params[i + 2], b = params[i + 3];
+            if (r === g && g === b && r > 4 && r < 247) return [232 + Math.min(Math.floor((r - 3) / 10), 23), 4];
+            return [16 + 36 * nearestLevel(r) + 6 * nearestLevel(g) + nearestLevel(b), 4];
+        }
+        return [-1, params.length - i];
+    }
+
+    function applySGR(s, params) {
+        if (params.length === 0) params = [0];
+        for (var i = 0; i < params.length; i++) {
+            var p = params[i];
+            if (p === 0) Object.assign(s, defaultStyle());
+            else if (p === 1) s.bold = true;
+            else if (p === 2) s.dim = true;
+            else if (p === 3) s.italic = true;
+            else if (p === 4) s.underline = true;
+            else if (p === 7) s.inverse = true;
+            else if (p === 9) s.strike = true;
+            else if (p === 21 || p === 22) { s.bold = false; s.dim = false; }
+            else if (p === 23) s.italic = false;
+            else if (p === 24) s.underline = false;
+            else if (p === 27) s.inverse = false;
+            else if (p === 29) s.strike = false;
+            else if (p >= 30 && p <= 37) s.fg = p - 30;
+            else if (p === 39) s.fg = -1;
+            else if (p >= 40 && p <= 47) s.bg = p - 40;
+            else if (p === 49) s.bg = -1;
+            else if (p >= 90 && p <= 97) s.fg = p - 90 + 8;
+            else if (p >= 100 && p <= 107) s.bg = p - 100 + 8;
+            else if (p === 38 || p === 48) {
+                var c = extendedColor(params, i + 1);
+                i += c[1];
+                if (c[0] >= 0) {
+                    if (p === 38) s.fg = c[0]; else s.bg = c[0];
+                }
+            }
+        }
+    }
+
+    // Terminal state
+    var term;
+
+    function blankLine(cls) {
+        var line = [];
+        for (var i = 0; i < cols; i++) line.push({ ch: ' ', cls: cls || '' });
+        return line;
+    }
+
+    function blankScreen() {
+        var screen = [];
+        for (var i = 0; i < rows; i++) screen.push(blankLine());
+        return screen;
+    }
+
+    function reset() {
+        term = {
+            screen: blankScreen(),
+            saved: null, // primary screen while the alternate one is shown
+            x: 0, y: 0,
+            savedCursor: { x: 0, y: 0 },
+            top: 0, bottom: rows - 1,
+            style: defaultStyle(),
+            cursorVisible: true,
+            pending: '' // incomplete escape sequence split across events
+        };
+    }
+
+    function clampCursor() {
+        term.x = Math.min(Math.max(term.x, 0), cols - 1);
+        term.y = Math.min(Math.max(term.y, 0), rows - 1);
+    }
+
+    function scrollUp(n) {
+        for (var i = 0; i < n; i++) {
+            term.screen.splice(term.top, 1);
+            term.screen.splice(term.bottom, 0, blankLine());
+        }
+    }
+
+    function scrollDown(n) {
+        for (var i = 0; i < n; i++) {
+            term.screen.splice(term.bottom, 1);
+            term.screen.splice(term.top, 0, blankLine());
+        }
+    }
+
+    function lineFeed() {
+        if (term.y === term.bottom) scrollUp(1);
+        else if (term.y < rows - 1) term.y++;
+    }
+
+    function eraseCells(y, from, to) {
+        var cls = term.style.bg >= 0 ? 'ansi-bg-' + term.style.bg : '';
+        for (var x = Math.max(from, 0); x < Math.min(to, cols); x++) term.screen[y][x] = { ch: ' ', cls: cls };
+    }
+
+    function put(ch) {
+        if (term.x >= cols) {
+            term.x = 0;
+            lineFeed();
+        }
+        term.screen[term.y][term.x] = { ch: ch, cls: styleClass(term.style) };
+        term.x++;
+    }
+
+    function csi(params, priv, final) {
+        var n = params[0] || 1;
+        switch (final) {
+            case 'm': applySGR(term.style, params); break;
+            case 'A': term.y = Math.max(term.y - n, term.top); break;
+            case 'B': term.y = Math.min(term.y + n, term.bottom); break;
+            case 'C': term.x += n; break;
+            case 'D': term.x = Math.min(term.x, cols - 1) - n; break;
+            case 'E': term.y += n; term.x = 0; break;
+            case 'F': term.y -= n; term.x = 0; break;
+            case 'G': case '`': term.x = n - 1; break;
+            case 'd': term.y = n - 1; break;
+            case 'H': case 'f': term.y = (params[0] || 1) - 1; term.x = (params[1] || 1) - 1; break;
+            case 'J':
+                var y;
+                if (params[0] === 2 || params[0] === 3) {
+                    for (y = 0; y < rows; y++) eraseCells(y, 0, cols);
+                } else if (params[0] === 1) {
+                    for (y = 0; y < term.y; y++) eraseCells(y, 0, cols);
+                    eraseCells(term.y, 0, term.x + 1);
+                } else {
+                    eraseCells(term.y, term.x, cols);
+                    for (y = term.y + 1; y < rows; y++) eraseCells(y, 0, cols);
+                }
+                break;
+            case 'K':
+                if (params[0] === 2) eraseCells(term.y, 0, cols);
+                else if (params[0] === 1) eraseCells(term.y, 0, term.x + 1);
+                else eraseCells(term.y, term.x, cols);
+                break;
+            case 'X': eraseCells(term.y, term.x, term.x + n); break;
+            case 'P':
+                term.screen[term.y].splice(term.x, n);
+                while (term.screen[term.y].length < cols) term.screen[term.y].push({ ch: ' ', cls: '' });
+                break;
+            case '@':
+                for (var i = 0; i < n; i++) term.screen[term.y].splice(term.x, 0, { ch: ' ', cls: '' });
+                term.screen[term.y].length = cols;
+                break;
+            case 'L': case 'M':
+                if (term.y < term.top || term.y > term.bottom) break;
+                var top = term.top;
+                term.top = term.y;
+                if (final === 'L') scrollDown(n); else scrollUp(n);
+                term.top = top;
+                break;
+            case 'S': scrollUp(n); break;
+            case 'T': scrollDown(n); break;
+            case 'r':
+                term.top = (params[0] || 1) - 1;
+                term.bottom = (params[1] || rows) - 1;
+                if (term.top >= term.bottom) { term.top = 0; term.bottom = rows - 1; }
+                term.x = 0; term.y = 0;
+                break;
+            case 's': term.savedCursor = { x: term.x, y: term.y }; break;
+            case 'u': term.x = term.savedCursor.x; term.y = term.savedCursor.y; break;
+            case 'h': case 'l':
+                if (priv !== '?') break;
+                var on = final === 'h';
+                params.forEach(function (mode) {
+                    if (mode === 25) term.cursorVisible = on;
+                    if ((mode === 1049 || mode === 47 || mode === 1047) && on !== (term.saved !== null)) {
+                        if (on) {
+                            term.saved = term.screen;
+                            term.savedCursor = { x: term.x, y: term.y };
+                            term.screen = blankScreen();
+                        } else {
+                            term.screen = term.saved;
+                            term.saved = null;
+                            term.x = term.savedCursor.x;
+                            term.y = term.savedCursor.y;
+                        }
+                    }
+                });
+                break;
+        }
+        clampCursor();
+    }
+
+    function write(text) {
+        text = term.pending + text;
+        term.pending = '';
+
+        for (var i = 0; i < text.length; i++) {
+            var c = text[i];
+            if (c === '\x1b') {
+                var next = text[i + 1];
+                if (next === undefined) { term.pending = text.slice(i); return; }
+                if (next === '[') {
+                    var end = i + 2;
+                    while (end < text.length && (text.charCodeAt(end) < 0x40 || text.charCodeAt(end) > 0x7e)) end++;
+                    if (end >= text.length) { term.pending = text.slice(i); return; }
+                    var body = text.slice(i + 2, end);
+                    var priv = /^[?>=<]/.test(body) ? body[0] : '';
+                    var params = body.slice(priv.length).split(/[;:]/).filter(function (p) { return p !== ''; }).map(Number);
+                    csi(params, priv, text[end]);
+                    i = end;
+                } else if (next === ']' || next === 'P' || next === '_' || next === '^') {
+                    var stop = text.slice(i + 2).search(/\x07|\x1b\\/);
+                    if (stop < 0) { term.pending = text.slice(i); return; }
+                    i += 2 + stop + (text[i + 2 + stop] === '\x07' ? 0 : 1);
+                } else if (next === '(' || next === ')' || next === '*' || next === '+') {
+                    if (i + 2 >= text.length) { term.pending = text.slice(i); return; }
+                    i += 2;
+                } else {
+                    if (next === '7') term.savedCursor = { x: term.x, y: term.y };
+                    else if (next === '8') { term.x = term.savedCursor.x; term.y = term.savedCursor.y; }
+                    else if (next === 'M') { if (term.y === term.top) scrollDown(1); else if (term.y > 0) term.y--; }
+                    else if (next === 'D') lineFeed();
+                    else if (next === 'E') { term.x = 0; lineFeed(); }
+                    else if (next === 'c') reset();
+                    i++;
+                }
+            } else if (c === '\n') {
+                lineFeed();
+            } else if (c === '\r') {
+                term.x = 0;
+            } else if (c === '\b') {
+                term.x = Math.max(Math.min(term.x, cols - 1) - 1, 0);
+            } else if (c === '\t') {
+                term.x = Math.min((Math.floor(term.x / 8) + 1) * 8, cols - 1);
+            } else if (c >= ' ' && c !== '\x7f') {
+                put(c);
+            }
+        }
+    }
+
+    function draw() {
+        var fragment = document.createDocumentFragment();
+        for (var y = 0; y < rows; y++) {
+            var line = term.screen[y];
+            var run = '', cls = null;
+            var flush = function () {
+                if (run === '') return;
+                if (cls) {
+                    var span = document.createElement('span');
+                    span.className = cls;
+                    span.textContent = run;
+                    fragment.appendChild(span);
+                } else {
+                    fragment.appendChild(document.createTextNode(run));
+                }
+                run = '';
+            };
+            for (var x = 0; x < cols; x++) {
+                var cell = line[x];
+                var cellClass = cell.cls;
+                if (term.cursorVisible && x === term.x && y === term.y && timer !== null) {
+                    cellClass = (cellClass ? cellClass + ' ' : '') + 'cursor';
+                }
+                if (cellClass !== cls) {
+                    flush();
+                    cls = cellClass;
+                }
+                run += cell.ch;
+            }
+            flush();
+            if (y < rows - 1) fragment.appendChild(document.createTextNode('\n'));
+        }
+        pre.replaceChildren(fragment);
+    }
+
+    // Playback
+    var events = data.events;
+    var index = 0, position = 0, speed = 1;
+    var timer = null, startedAt = 0, startPosition = 0;
+
+    function formatTime(seconds) {
+        var s = Math.floor(seconds);
+        var m = Math.floor(s / 60);
+        if (m >= 60) return Math.floor(m / 60) + ':' + String(m % 60).padStart(2, '0') + ':' + String(s % 60).padStart(2, '0');
+        return m + ':' + String(s % 60).padStart(2, '0');
+    }
+
+    function update() {
+        timeLabel.textContent = formatTime(position);
+        seek.value = data.duration > 0 ? Math.round(position / data.duration * 1000) : 0;
+        draw();
+    }
+
+    // Applies events up to the current position
+    function advance() {
+        while (index < events.length && events[index][0] <= position) {
+            write(events[index][1]);
+            index++;
+        }
+    }
+
+    function tick() {
+        position = startPosition + (performance.now() - startedAt) / 1000 * speed;
+        if (position >= data.duration) {
+            position = data.duration;
+            advance();
+            pause();
+            return;
+        }
+        advance();
+        update();
+        timer = requestAnimationFrame(tick);
+    }
+
+    function play() {
+        if (position >= data.duration) seekTo(0);
+        startedAt = performance.now();
+        startPosition = position;
+        playButton.textContent = 'Pause';
+        timer = requestAnimationFrame(tick);
+    }
+
+    function pause() {
+        if (timer !== null) cancelAnimationFrame(timer);
+        timer = null;
+        playButton.textContent = 'Play';
+        update();
+    }
+
+    function seekTo(seconds) {
+        if (seconds < position) {
+            reset();
+            index = 0;
+        }
+        position = Math.min(Math.max(seconds, 0), data.duration);
+        advance();
+        startedAt = performance.now();
+        startPosition = position;
+        update();
+    }
+
+    playButton.addEventListener('click', function () {
+        if (timer === null) play(); else pause();
+    });
+    seek.addEventListener('input', function () {
+        seekTo(seek.value / 1000 * data.duration);
+    });
+    speedSelect.addEventListener('change', function () {
+        startPosition = position;
+        startedAt = performance.now();
+        speed = Number(speedSelect.value);
+    });
+    document.addEventListener('keydown', function (e) {
+        if (e.key !== ' ' || e.target !== document.body) return;
+        e.preventDefault();
+        playButton.click();
+    });
+
+    // The transcript rendered by the server is replaced by the player, which
+    // starts out showing the final screen
+    reset();
+    controls.hidden = false;
+    seekTo(data.duration);
+})();
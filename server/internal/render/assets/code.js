@@ -0,0 +1,38 @@
+// Highlight the line range in the URL fragment (#L10 or #L10-L20).
+// Shift-click a line number to extend the selected range.
+(function () {
+    function range() {
+        var m = location.hash.match(/^#L(\d+)(?:-L(\d+))?$/);
+        if (!m) return null;
+        var start = parseInt(m[1], 10), end = m[2] ? parseInt(m[2], 10) : start;
+        return start <= end ? [start, end] : [end, start];
+    }
+
+    function highlightRange() {
+        document.querySelectorAll('.line.hl').forEach(function (line) {
+            line.classList.remove('hl');
+        });
+        var r = range();
+        if (!r) return;
+        for (var i = r[0]; i <= r[1]; i++) {
+            var ln = document.getElementById('L' + i);
+            if (ln) ln.parentNode.classList.add('hl');
+        }
+        var first = document.getElementById('L' + r[0]);
+        if (first) first.scrollIntoView({ block: 'center' });
+    }
+
+    document.addEventListener('click', function (e) {
+        var link = e.target.closest('.ln a');
+        if (!link || !e.shiftKey) return;
+        var r = range();
+        if (!r) return;
+        e.preventDefault();
+        var line = parseInt(link.getAttribute('href').slice(2), 10);
+        var start = Math.min(r[0], line), end = Math.max(r[1], line);
+        location.hash = start === end ? '#L' + start : '#L' + start + '-L' + end;
+    });
+
+    window.addEventListener('hashchange', highlightRange);
+    highlightRange();
+})();
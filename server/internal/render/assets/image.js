@@ -0,0 +1,13 @@
+// Toggle between fitting the image to the window and showing it at actual size
+(function () {
+    var image = document.getElementById('image');
+    var button = document.getElementById('zoom');
+
+    function toggle() {
+        var fit = image.classList.toggle('fit');
+        button.textContent = fit ? 'Actual size' : 'Fit to window';
+    }
+
+    image.addEventListener('click', toggle);
+    button.addEventListener('click', toggle);
+})();
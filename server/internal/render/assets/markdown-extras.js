@@ -0,0 +1,70 @@
+// Typeset math with KaTeX and draw Mermaid and Graphviz diagrams, for the
+// libraries the page loads. Diagrams are shown as SVG images: the CSP blocks
+// the style elements in their markup inline, but not inside an image.
+(function () {
+    function svgImage(svg, label) {
+        var img = document.createElement('img');
+        img.className = 'diagram';
+        img.alt = label;
+        img.src = 'data:image/svg+xml;charset=utf-8,' + encodeURIComponent(svg);
+        return img;
+    }
+
+    function showError(code, err) {
+        var pre = code.parentNode;
+        pre.classList.add('diagram-error');
+        pre.title = String((err && err.message) || err);
+    }
+
+    if (window.katex) {
+        document.querySelectorAll('.math').forEach(function (el) {
+            katex.render(el.textContent, el, {
+                displayMode: el.classList.contains('math-display'),
+                throwOnError: false
+            });
+        });
+        document.querySelectorAll('pre > code.language-math').forEach(function (code) {
+            var div = document.createElement('div');
+            div.className = 'math math-display';
+            katex.render(code.textContent, div, { displayMode: true, throwOnError: false });
+            code.parentNode.replaceWith(div);
+        });
+    }
+
+    if (window.mermaid) {
+        // The page theme sets color-scheme, which resolves auto
+        var dark = getComputedStyle(document.documentElement).colorScheme !== 'light';
+        mermaid.initialize({
+            startOnLoad: false,
+            securityLevel: 'strict',
+            theme: dark ? 'dark' : 'default',
+            flowchart: { htmlLabels: false }
+        });
+        // Rendered one after another, mermaid keeps global state while drawing
+        var queue = Promise.resolve();
+        document.querySelectorAll('pre > code.language-mermaid').forEach(function (code, i) {
+            queue = queue.then(function () {
+                return mermaid.render('mermaid-' + i, code.textContent);
+            }).then(function (result) {
+                code.parentNode.replaceWith(svgImage(result.svg, 'Diagram'));
+            }, function (err) {
+                showError(code, err);
+            });
+        });
+    }
+
+    if (window.Viz) {
+        var graphs = document.querySelectorAll('pre > code.language-dot, pre > code.language-graphviz');
+        if (graphs.length > 0) {
+            Viz.instance().then(function (viz) {
+                graphs.forEach(function (code) {
+                    try {
+                        code.parentNode.replaceWith(svgImage(viz.renderString(code.textContent, { format: 'svg' }), 'Graph'));
+                    } catch (err) {
+                        showError(code, err);
+                    }
+                });
+            });
+        }
+    }
+})();
@@ -0,0 +1,58 @@
+// Render the PDF with the self-hosted pdf.js build, one canvas per page drawn
+// as it scrolls into view. Without pdf.js the browser's own viewer is kept.
+(function () {
+    var viewer = document.getElementById('pdf-viewer');
+    var lib = viewer.dataset.pdfjs;
+    if (!lib) return;
+
+    function drawPage(page, container) {
+        var scale = container.clientWidth / page.getViewport({ scale: 1 }).width;
+        var viewport = page.getViewport({ scale: scale * (window.devicePixelRatio || 1) });
+        var canvas = document.createElement('canvas');
+        canvas.width = viewport.width;
+        canvas.height = viewport.height;
+        container.appendChild(canvas);
+        return page.render({ canvasContext: canvas.getContext('2d'), viewport: viewport }).promise;
+    }
+
+    import(lib).then(function (pdfjs) {
+        pdfjs.GlobalWorkerOptions.workerSrc = viewer.dataset.worker;
+        return pdfjs.getDocument({ url: viewer.dataset.src, isEvalSupported: false }).promise;
+    }).then(function (doc) {
+        var pages = document.createElement('div');
+        pages.className = 'pdf-pages';
+        var width = Math.min(viewer.clientWidth, 960);
+
+        var observer = new IntersectionObserver(function (entries) {
+            entries.forEach(function (entry) {
+                if (!entry.isIntersecting) return;
+                var container = entry.target;
+                observer.unobserve(container);
+                doc.getPage(Number(container.dataset.page)).then(function (page) {
+                    return drawPage(page, container);
+                });
+            });
+        }, { rootMargin: '200px' });
+
+        // Pages are sized from the first one until drawn, most documents are uniform
+        return doc.getPage(1).then(function (first) {
+            var size = first.getViewport({ scale: 1 });
+            for (var i = 1; i <= doc.numPages; i++) {
+                var container = document.createElement('div');
+                container.className = 'pdf-page';
+                container.id = 'page-' + i;
+                container.dataset.page = i;
+                container.style.width = width + 'px';
+                container.style.aspectRatio = size.width + ' / ' + size.height;
+                pages.appendChild(container);
+                observer.observe(container);
+            }
+            viewer.replaceChildren(pages);
+        });
+    }).catch(function () {
+        var error = document.createElement('p');
+        error.className = 'pdf-error';
+        error.textContent = 'The document could not be displayed in the viewer.';
+        viewer.prepend(error);
+    });
+})();
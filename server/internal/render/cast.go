@@ -0,0 +1,149 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// castHeader is the first line of an asciicast v2 recording
+type castHeader struct {
+	Version       int     `json:"version"`
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	Title         string  `json:"title"`
+	IdleTimeLimit float64 `json:"idle_time_limit"`
+}
+
+// castData is what the player is given: the terminal size and the output
+// events as [seconds, text] with idle time already capped
+type castData struct {
+	Width    int          `json:"width"`
+	Height   int          `json:"height"`
+	Duration float64      `json:"duration"`
+	Events   [][2]any     `json:"events"`
+	output   bytes.Buffer // all output, for the transcript shown without script
+}
+
+// maxCastIdle caps pauses in recordings that do not set idle_time_limit
+const maxCastIdle = 5.0
+
+// IsCast reports whether content is an asciinema recording
+func IsCast(contentType string, filename string) bool {
+	return strings.Contains(strings.ToLower(contentType), "asciicast") ||
+		strings.EqualFold(filepath.Ext(filename), ".cast")
+}
+
+// parseCast reads an asciicast v2 file, one JSON value per line
+func parseCast(content []byte) (*castHeader, *castData, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		return nil, nil, errors.New("empty recording")
+	}
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse cast header: %w", err)
+	}
+	if header.Version != 2 || header.Width <= 0 || header.Height <= 0 {
+		return nil, nil, errors.New("unsupported cast version")
+	}
+
+	idleLimit := header.IdleTimeLimit
+	if idleLimit <= 0 {
+		idleLimit = maxCastIdle
+	}
+
+	data := &castData{Width: header.Width, Height: header.Height, Events: [][2]any{}}
+	var last, elapsed float64
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var event []json.RawMessage
+		if err := json.Unmarshal(line, &event); err != nil || len(event) < 3 {
+			return nil, nil, errors.New("failed to parse cast event")
+		}
+		var at float64
+		var code, text string
+		if json.Unmarshal(event[0], &at) != nil || json.Unmarshal(event[1], &code) != nil || json.Unmarshal(event[2], &text) != nil {
+			return nil, nil, errors.New("failed to parse cast event")
+		}
+		// Input, marker and resize events are not played back
+		if code != "o" {
+			continue
+		}
+
+		elapsed += min(max(at-last, 0), idleLimit)
+		last = at
+		data.Events = append(data.Events, [2]any{elapsed, text})
+		data.output.WriteString(text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read cast: %w", err)
+	}
+
+	data.Duration = elapsed
+	return &header, data, nil
+}
+
+func renderCast(content []byte, filename string, rawURL string) ([]byte, error) {
+	header, data, err := parseCast(content)
+	if err != nil {
+		return nil, err
+	}
+
+	title := header.Title
+	if title == "" {
+		title = filename
+	}
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	// json.Marshal escapes <, > and &, so the data cannot end the script element
+	events, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var transcript strings.Builder
+	for i, line := range parseANSI(data.output.String()) {
+		if i > 0 {
+			transcript.WriteByte('\n')
+		}
+		writeANSIRuns(&transcript, line)
+	}
+
+	duration := time.Duration(data.Duration * float64(time.Second)).Round(time.Second)
+	details := fmt.Sprintf("%d×%d · %s", data.Width, data.Height, formatDuration(duration))
+
+	// One pass, so placeholders in the title, data or transcript are left alone
+	result := strings.NewReplacer(
+		"{{TITLE}}", html.EscapeString(title),
+		"{{RAW_URL}}", html.EscapeString(rawURL),
+		"{{DETAILS}}", html.EscapeString(details),
+		"{{TRANSCRIPT}}", transcript.String(),
+		"{{CAST_DATA}}", string(events),
+	).Replace(castPage)
+
+	return []byte(result), nil
+}
+
+// formatDuration formats a duration as m:ss or h:mm:ss
+func formatDuration(d time.Duration) string {
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
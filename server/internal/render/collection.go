@@ -0,0 +1,107 @@
+package render
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"path"
+	"strings"
+)
+
+// CollectionType is the content type of a collection share, whose content
+// is a Collection listing the files shared together
+const CollectionType = "application/x-share-collection+json"
+
+// Collection lists the members of a collection share. Each member is an
+// item of its own, so keeps its URL and views.
+type Collection struct {
+	Members []CollectionMember `json:"members"`
+}
+
+// CollectionMember is a file shared as part of a collection
+type CollectionMember struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"` // path within the collection, as uploaded
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Preview     string `json:"preview,omitempty"` // URL of an image preview
+	Excerpt     string `json:"excerpt,omitempty"` // first lines of text files
+}
+
+// ParseCollection decodes the content of a collection share
+func ParseCollection(content []byte) (*Collection, error) {
+	var c Collection
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse collection: %w", err)
+	}
+	return &c, nil
+}
+
+// Size returns the total size of the members
+func (c *Collection) Size() int64 {
+	var total int64
+	for _, m := range c.Members {
+		total += m.Size
+	}
+	return total
+}
+
+// Summary describes the collection, e.g. "5 files, 2.1 MB"
+func (c *Collection) Summary() string {
+	if len(c.Members) == 1 {
+		return "1 file, " + humanSize(c.Size())
+	}
+	return fmt.Sprintf("%d files, %s", len(c.Members), humanSize(c.Size()))
+}
+
+func renderCollection(content []byte, filename string, rawURL string) ([]byte, error) {
+	c, err := ParseCollection(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Members) == 0 {
+		return nil, errors.New("empty collection")
+	}
+
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	var b strings.Builder
+	for _, m := range c.Members {
+		href := html.EscapeString("/" + m.ID)
+		name := html.EscapeString(m.Name)
+
+		fmt.Fprintf(&b, `<li><a href="%s"><div class="preview">`, href)
+		switch {
+		case m.Preview != "":
+			fmt.Fprintf(&b, `<img src="%s" alt="%s" loading="lazy">`, html.EscapeString(m.Preview), name)
+		case m.Excerpt != "":
+			fmt.Fprintf(&b, `<pre>%s</pre>`, html.EscapeString(m.Excerpt))
+		default:
+			fmt.Fprintf(&b, `<span class="kind">%s</span>`, html.EscapeString(memberKind(m)))
+		}
+		fmt.Fprintf(&b, `</div><div class="info"><span class="name" title="%s">%s</span><span class="size">%s</span></div></a></li>`,
+			name, name, humanSize(m.Size))
+	}
+
+	result := strings.ReplaceAll(collectionPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{SUMMARY}}", html.EscapeString(c.Summary()))
+	// Content last so placeholders inside member names are left alone
+	result = strings.Replace(result, "{{CONTENT}}", b.String(), 1)
+
+	return []byte(result), nil
+}
+
+// memberKind labels a member without a preview by its extension, or its
+// type if it has none
+func memberKind(m CollectionMember) string {
+	if ext := strings.TrimPrefix(path.Ext(m.Name), "."); ext != "" && len(ext) <= 5 {
+		return ext
+	}
+	kind, _, _ := strings.Cut(baseContentType(m.ContentType), "/")
+	return kind
+}
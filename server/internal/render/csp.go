@@ -0,0 +1,68 @@
+package render
+
+import "strings"
+
+// Content Security Policies for rendered views. All styles and scripts are
+// served from AssetPrefix, so views only need to allow 'self'.
+var (
+	markdownCSP   = pagePolicy(markdownPage)
+	codeCSP       = pagePolicy(codePage)
+	mediaCSP      = pagePolicy(mediaPage)
+	imageCSP      = pagePolicy(imagePage)
+	tableCSP      = pagePolicy(tablePage)
+	notebookCSP   = pagePolicy(notebookPage)
+	diffCSP       = pagePolicy(diffPage)
+	archiveCSP    = pagePolicy(archivePage)
+	pdfCSP        = pagePolicy(pdfPage)
+	castCSP       = pagePolicy(castPage)
+	collectionCSP = pagePolicy(collectionPage)
+)
+
+// ContentSecurityPolicy returns the CSP header value for the default view of
+// a content type
+func ContentSecurityPolicy(contentType string, opts Options) string {
+	if views := Views(contentType, ""); len(views) > 0 {
+		return views[0].Policy(opts)
+	}
+	return codeCSP
+}
+
+// pagePolicy builds a CSP for a page, allowing scripts, form submissions and
+// embedded documents only if it uses any
+func pagePolicy(page string) string {
+	scriptSrc := "script-src 'none'"
+	if strings.Contains(page, "<script") {
+		scriptSrc = "script-src 'self'"
+		// Graphviz is compiled to WebAssembly
+		if strings.Contains(page, vizAsset) {
+			scriptSrc += " 'wasm-unsafe-eval'"
+		}
+	}
+	formAction := "form-action 'none'"
+	if strings.Contains(page, "<form") {
+		formAction = "form-action 'self'"
+	}
+
+	directives := []string{
+		"default-src 'none'",
+		scriptSrc,
+		"style-src 'self'",
+		"img-src 'self' data:",
+		"media-src 'self'",
+		"base-uri 'none'",
+		formAction,
+		"frame-ancestors 'none'",
+	}
+	if strings.Contains(page, "<object") {
+		directives = append(directives, "object-src 'self'")
+	}
+	if strings.Contains(page, katexStyleAsset) {
+		directives = append(directives, "font-src 'self'")
+	}
+	// pdf.js fetches the document and parses it in a worker
+	if strings.Contains(page, "data-pdfjs") {
+		directives = append(directives, "connect-src 'self'", "worker-src 'self'")
+	}
+
+	return strings.Join(directives, "; ")
+}
@@ -0,0 +1,321 @@
+package render
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// diffFile is one file's section of a unified diff
+type diffFile struct {
+	oldName string
+	newName string
+	headers []string // extended headers, e.g. mode changes and renames
+	hunks   []*diffHunk
+	added   int
+	removed int
+}
+
+type diffHunk struct {
+	header string
+	lines  []diffLine
+}
+
+type diffLine struct {
+	kind   byte // ' ', '+', '-', or '\\' for "No newline at end of file"
+	text   string
+	oldNum int
+	newNum int
+}
+
+// diffLineClass is the CSS class of each kind of line
+var diffLineClass = map[byte]string{'+': "add", '-': "del", ' ': "ctx", '\\': "meta"}
+
+// hunkHeader matches "@@ -start,count +start,count @@ section"
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// IsDiff reports whether content is a unified diff or patch
+func IsDiff(contentType string, filename string) bool {
+	ct := baseContentType(contentType)
+	if ct == "text/x-diff" || ct == "text/x-patch" {
+		return true
+	}
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".diff" || ext == ".patch"
+}
+
+// parseDiff splits a unified diff into files and hunks. Text before the first
+// file, such as the commit message of a git format-patch, is returned as preamble.
+func parseDiff(content []byte) (preamble string, files []*diffFile, err error) {
+	var (
+		file             *diffFile
+		hunk             *diffHunk
+		oldLine, newLine int
+		oldLeft, newLeft int // lines remaining in the current hunk
+		before           []string
+	)
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	for _, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+
+		// Inside a hunk every line is content, even if it looks like a header
+		if hunk != nil && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(line, `\`)) {
+			kind := byte(' ')
+			if line != "" {
+				kind = line[0]
+			}
+			text := line
+			if len(text) > 0 {
+				text = text[1:]
+			}
+
+			switch kind {
+			case '+':
+				newLine++
+				newLeft--
+				file.added++
+				hunk.lines = append(hunk.lines, diffLine{kind: kind, text: text, newNum: newLine})
+				continue
+			case '-':
+				oldLine++
+				oldLeft--
+				file.removed++
+				hunk.lines = append(hunk.lines, diffLine{kind: kind, text: text, oldNum: oldLine})
+				continue
+			case ' ':
+				oldLine++
+				newLine++
+				oldLeft--
+				newLeft--
+				hunk.lines = append(hunk.lines, diffLine{kind: kind, text: text, oldNum: oldLine, newNum: newLine})
+				continue
+			case '\\':
+				hunk.lines = append(hunk.lines, diffLine{kind: kind, text: text})
+				continue
+			}
+			// Anything else ends a hunk whose counts were wrong
+		}
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = &diffFile{}
+			files = append(files, file)
+			hunk = nil
+			if a, b, ok := strings.Cut(strings.TrimPrefix(line, "diff --git "), " b/"); ok {
+				file.oldName = strings.TrimPrefix(a, "a/")
+				file.newName = b
+			}
+
+		case strings.HasPrefix(line, "--- "):
+			// Plain diffs have no "diff --git" line, "---" starts the next file
+			if file == nil || len(file.hunks) > 0 {
+				file = &diffFile{}
+				files = append(files, file)
+			}
+			hunk = nil
+			file.oldName = diffPath(strings.TrimPrefix(line, "--- "), "a/")
+
+		case strings.HasPrefix(line, "+++ ") && file != nil:
+			file.newName = diffPath(strings.TrimPrefix(line, "+++ "), "b/")
+
+		case strings.HasPrefix(line, "@@ ") && file != nil:
+			m := hunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				return "", nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			oldLine, _ = strconv.Atoi(m[1])
+			newLine, _ = strconv.Atoi(m[3])
+			oldLeft, newLeft = hunkCount(m[2]), hunkCount(m[4])
+			// Counters hold the number of the previous line
+			oldLine--
+			newLine--
+			if oldLeft == 0 {
+				oldLine++
+			}
+			if newLeft == 0 {
+				newLine++
+			}
+			hunk = &diffHunk{header: line}
+			file.hunks = append(file.hunks, hunk)
+
+		case file != nil:
+			if !strings.HasPrefix(line, "index ") && line != "" {
+				file.headers = append(file.headers, line)
+			}
+
+		default:
+			before = append(before, line)
+		}
+	}
+
+	if len(files) == 0 {
+		return "", nil, errors.New("no files in diff")
+	}
+	return strings.TrimSpace(strings.Join(before, "\n")), files, nil
+}
+
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath strips the a/ or b/ prefix and any timestamp from a file header
+func diffPath(name string, prefix string) string {
+	name, _, _ = strings.Cut(name, "\t")
+	if name == "/dev/null" {
+		return name
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// displayName names a file for its section heading
+func (f *diffFile) displayName() string {
+	switch {
+	case f.newName == "/dev/null" || f.newName == "":
+		return f.oldName
+	case f.oldName == "/dev/null" || f.oldName == "" || f.oldName == f.newName:
+		return f.newName
+	}
+	return f.oldName + " → " + f.newName
+}
+
+func renderDiff(content []byte, filename string, rawURL string, split bool) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	preamble, files, err := parseDiff(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	if preamble != "" {
+		fmt.Fprintf(&b, `<pre class="diff-preamble">%s</pre>`, html.EscapeString(preamble))
+	}
+
+	// File list with per-file stats
+	added, removed := 0, 0
+	b.WriteString(`<ul class="diff-files">`)
+	for i, f := range files {
+		added += f.added
+		removed += f.removed
+		fmt.Fprintf(&b, `<li><a href="#file-%d">%s</a> %s</li>`, i+1, html.EscapeString(f.displayName()), diffStats(f.added, f.removed))
+	}
+	b.WriteString(`</ul>`)
+
+	for i, f := range files {
+		fmt.Fprintf(&b, `<details class="diff-file" id="file-%d" open><summary><span class="diff-name">%s</span> %s</summary>`,
+			i+1, html.EscapeString(f.displayName()), diffStats(f.added, f.removed))
+		for _, h := range f.headers {
+			fmt.Fprintf(&b, `<div class="diff-meta">%s</div>`, html.EscapeString(h))
+		}
+		for _, hunk := range f.hunks {
+			fmt.Fprintf(&b, `<details class="diff-hunk" open><summary>%s</summary>`, html.EscapeString(hunk.header))
+			if split {
+				writeSplitHunk(&b, hunk)
+			} else {
+				writeUnifiedHunk(&b, hunk)
+			}
+			b.WriteString(`</details>`)
+		}
+		b.WriteString(`</details>`)
+	}
+
+	summary := fmt.Sprintf("%d files changed, %d insertions(+), %d deletions(-)", len(files), added, removed)
+	unifiedClass, splitClass := ` class="active"`, ""
+	if split {
+		unifiedClass, splitClass = "", ` class="active"`
+	}
+
+	result := strings.ReplaceAll(diffPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{SUMMARY}}", html.EscapeString(summary))
+	result = strings.ReplaceAll(result, "{{UNIFIED_CLASS}}", unifiedClass)
+	result = strings.ReplaceAll(result, "{{SPLIT_CLASS}}", splitClass)
+	// Content last so placeholders inside the diff are left alone
+	result = strings.Replace(result, "{{CONTENT}}", b.String(), 1)
+
+	return []byte(result), nil
+}
+
+func diffStats(added, removed int) string {
+	return fmt.Sprintf(`<span class="diff-stats"><span class="add">+%d</span> <span class="del">−%d</span></span>`, added, removed)
+}
+
+func lineNumber(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func writeUnifiedHunk(b *strings.Builder, hunk *diffHunk) {
+	b.WriteString(`<table class="diff-table unified">`)
+	for _, l := range hunk.lines {
+		fmt.Fprintf(b, `<tr class="%s"><td class="ln">%s</td><td class="ln">%s</td><td class="code">%c%s</td></tr>`,
+			diffLineClass[l.kind], lineNumber(l.oldNum), lineNumber(l.newNum), l.kind, html.EscapeString(l.text))
+	}
+	b.WriteString(`</table>`)
+}
+
+// writeSplitHunk shows old and new side by side, pairing each run of removed
+// lines with the added lines that follow it
+func writeSplitHunk(b *strings.Builder, hunk *diffHunk) {
+	b.WriteString(`<table class="diff-table split">`)
+
+	lines := hunk.lines
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		switch l.kind {
+		case ' ':
+			text := html.EscapeString(l.text)
+			fmt.Fprintf(b, `<tr class="ctx"><td class="ln">%d</td><td class="code">%s</td><td class="ln">%d</td><td class="code">%s</td></tr>`,
+				l.oldNum, text, l.newNum, text)
+			i++
+		case '\\':
+			fmt.Fprintf(b, `<tr class="meta"><td class="ln"></td><td class="code" colspan="3">\%s</td></tr>`, html.EscapeString(l.text))
+			i++
+		default:
+			var dels, adds []diffLine
+			for i < len(lines) && lines[i].kind == '-' {
+				dels = append(dels, lines[i])
+				i++
+			}
+			for i < len(lines) && lines[i].kind == '+' {
+				adds = append(adds, lines[i])
+				i++
+			}
+			for j := 0; j < max(len(dels), len(adds)); j++ {
+				b.WriteString("<tr>")
+				writeSplitSide(b, dels, j, "del")
+				writeSplitSide(b, adds, j, "add")
+				b.WriteString("</tr>")
+			}
+		}
+	}
+
+	b.WriteString(`</table>`)
+}
+
+func writeSplitSide(b *strings.Builder, lines []diffLine, i int, class string) {
+	if i >= len(lines) {
+		b.WriteString(`<td class="ln empty"></td><td class="code empty"></td>`)
+		return
+	}
+	num := lines[i].oldNum
+	if class == "add" {
+		num = lines[i].newNum
+	}
+	fmt.Fprintf(b, `<td class="ln %s">%d</td><td class="code %s">%s</td>`, class, num, class, html.EscapeString(lines[i].text))
+}
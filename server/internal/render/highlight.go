@@ -0,0 +1,121 @@
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// highlightStyle is the chroma color scheme used for code views. Tokens are
+// marked up with classes, so it only affects the generated class names.
+var highlightStyle = highlightStyles[ThemeDark]
+
+// highlightStyles are the chroma color schemes of each theme
+var highlightStyles = map[string]*chroma.Style{
+	ThemeDark:  styles.Get("github-dark"),
+	ThemeLight: styles.Get("github"),
+}
+
+// highlighter formats tokens as HTML with CSS classes, since the CSP blocks
+// inline style attributes. Line numbers link to #L<n> anchors.
+var highlighter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.WithLineNumbers(true),
+	chromahtml.WithLinkableLineNumbers(true, "L"),
+	chromahtml.TabWidth(4),
+)
+
+// snippetHighlighter formats short code blocks embedded in a page, such as
+// notebook cells, without line numbers since their anchors would collide
+var snippetHighlighter = chromahtml.New(
+	chromahtml.WithClasses(true),
+	chromahtml.TabWidth(4),
+)
+
+// highlightCSS is the stylesheet for the highlighter's classes, with the
+// colors of each theme
+var highlightCSS = func() string {
+	var css strings.Builder
+	for _, theme := range []string{ThemeDark, ThemeLight} {
+		var buf bytes.Buffer
+		if err := highlighter.WriteCSS(&buf, highlightStyles[theme]); err != nil {
+			return ""
+		}
+		// The views set the background, which scoped rules would override
+		rules := pageBackground.ReplaceAllString(buf.String(), "")
+		css.WriteString(forTheme(rules, theme))
+	}
+	return css.String()
+}()
+
+// pageBackground matches the highlighter's rules for the background of the
+// code block
+var pageBackground = regexp.MustCompile(`(?m)^/\* (Background|PreWrapper) \*/ .*\n`)
+
+// highlight renders code as HTML with syntax highlighting and line numbers.
+// Content larger than maxSize (if non-zero) is shown as plain text.
+func highlight(content []byte, filename string, language string, maxSize int64) ([]byte, error) {
+	lexer := lexerFor(content, filename, language)
+	if maxSize > 0 && int64(len(content)) > maxSize {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := highlighter.Format(&buf, highlightStyle, iterator); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// highlightSnippet renders a code block as HTML with syntax highlighting
+func highlightSnippet(content []byte, language string) ([]byte, error) {
+	lexer := chroma.Coalesce(lexerFor(content, "", language))
+
+	iterator, err := lexer.Tokenise(nil, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := snippetHighlighter.Format(&buf, highlightStyle, iterator); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// lexerFor picks a lexer by detected language, then filename, then content
+func lexerFor(content []byte, filename string, language string) chroma.Lexer {
+	if language != "" {
+		if lexer := lexers.Get(language); lexer != nil {
+			return lexer
+		}
+	}
+
+	if filename != "" {
+		if lexer := lexers.Match(filename); lexer != nil {
+			return lexer
+		}
+	}
+
+	// Analysing is expensive, only look at the start of the content
+	sample := content
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	if lexer := lexers.Analyse(strings.ToValidUTF8(string(sample), "")); lexer != nil {
+		return lexer
+	}
+
+	return lexers.Fallback
+}
@@ -0,0 +1,179 @@
+package render
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Diagram and math libraries are not part of the repository, see
+// scripts/fetch-assets.sh. Features whose library is missing stay off.
+const (
+	mermaidAsset    = "mermaid.min.js"
+	vizAsset        = "viz-standalone.js"
+	katexAsset      = "katex.min.js"
+	katexStyleAsset = "katex.min.css"
+)
+
+// markdown converts Markdown to HTML with GitHub Flavored Markdown extensions
+var markdown = newMarkdown()
+
+// mathMarkdown also parses $...$ and $$...$$ math, for when it is enabled
+var mathMarkdown = newMarkdown(&mathExtension{})
+
+func newMarkdown(extensions ...goldmark.Extender) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(append([]goldmark.Extender{
+			extension.Linkify,
+			extension.Strikethrough,
+			extension.TaskList,
+			extension.Footnote,
+			// Align attributes instead of inline styles, which the CSP blocks
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		}, extensions...)...),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(
+			// Raw HTML is passed through and removed by the sanitizer instead
+			html.WithUnsafe(),
+			renderer.WithNodeRenderers(util.Prioritized(&headingRenderer{}, 100)),
+		),
+	)
+}
+
+// sanitizer strips anything from rendered Markdown that could run script or
+// restyle the page, keeping the markup goldmark produces for GFM features
+var sanitizer = newSanitizer()
+
+func newSanitizer() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	// Task list checkboxes
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+
+	// Heading anchors, footnotes and code block languages
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(anchor|footnotes|footnote-ref|footnote-backref)$`)).OnElements("a", "div")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+	p.AllowAttrs("aria-hidden").Matching(regexp.MustCompile(`^true$`)).OnElements("a")
+
+	// Math typeset in the browser
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^math math-(inline|display)$`)).OnElements("span", "div")
+
+	return p
+}
+
+// markdownToHTML renders Markdown to sanitized HTML, with math if enabled
+func markdownToHTML(content []byte, math bool) ([]byte, error) {
+	md := markdown
+	if math {
+		md = mathMarkdown
+	}
+
+	var buf bytes.Buffer
+	if err := md.Convert(content, &buf); err != nil {
+		return nil, err
+	}
+	return sanitizer.SanitizeBytes(buf.Bytes()), nil
+}
+
+// markdownText returns the text of a Markdown document without markup, code
+// blocks or raw HTML, one line per block
+func markdownText(content []byte) string {
+	doc := markdown.Parser().Parse(text.NewReader(content))
+
+	var b strings.Builder
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			if n.Type() == ast.TypeBlock {
+				b.WriteByte('\n')
+			}
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.CodeBlock, *ast.FencedCodeBlock, *ast.HTMLBlock:
+			return ast.WalkSkipChildren, nil
+		case *ast.Text:
+			b.Write(n.Segment.Value(content))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.AutoLink:
+			b.Write(n.Label(content))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// markdownExtras returns the tags loading the libraries for the enabled
+// diagram and math features, empty if there are none
+func markdownExtras(opts Options) string {
+	var names []string
+	if opts.Diagrams {
+		names = append(names, mermaidAsset, vizAsset)
+	}
+	if opts.Math {
+		names = append(names, katexStyleAsset, katexAsset)
+	}
+
+	var tags []string
+	for _, name := range names {
+		if a, ok := LookupAsset(name); ok {
+			tags = append(tags, assetTag(a))
+		}
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+
+	tags = append(tags, assetTag(assets["markdown-extras.js"]))
+	return strings.Join(tags, "\n    ")
+}
+
+// headingRenderer renders headings with a self-link anchor
+type headingRenderer struct{}
+
+func (r *headingRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r *headingRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Heading)
+	if !entering {
+		_, _ = w.WriteString("</h")
+		_ = w.WriteByte("0123456"[n.Level])
+		_, _ = w.WriteString(">\n")
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString("<h")
+	_ = w.WriteByte("0123456"[n.Level])
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, node, html.HeadingAttributeFilter)
+	}
+	_ = w.WriteByte('>')
+
+	if id, ok := n.AttributeString("id"); ok {
+		if idBytes, ok := id.([]byte); ok {
+			_, _ = w.WriteString(`<a class="anchor" aria-hidden="true" href="#`)
+			_, _ = w.Write(util.EscapeHTML(idBytes))
+			_, _ = w.WriteString(`">#</a>`)
+		}
+	}
+	return ast.WalkContinue, nil
+}
@@ -0,0 +1,221 @@
+package render
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// notebook is the subset of the Jupyter nbformat 4 schema that is rendered
+type notebook struct {
+	NBFormat int `json:"nbformat"`
+	Metadata struct {
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+type notebookCell struct {
+	CellType       string           `json:"cell_type"`
+	Source         multiline        `json:"source"`
+	ExecutionCount *int             `json:"execution_count"`
+	Outputs        []notebookOutput `json:"outputs"`
+}
+
+type notebookOutput struct {
+	OutputType     string               `json:"output_type"`
+	Name           string               `json:"name"` // stream: stdout or stderr
+	Text           multiline            `json:"text"`
+	Data           map[string]multiline `json:"data"`
+	ExecutionCount *int                 `json:"execution_count"`
+	EName          string               `json:"ename"`
+	EValue         string               `json:"evalue"`
+	Traceback      []string             `json:"traceback"`
+}
+
+// multiline is a notebook string, stored either as one string or as a list of lines
+type multiline string
+
+func (m *multiline) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*m = multiline(strings.Join(lines, ""))
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*m = multiline(s)
+	return nil
+}
+
+// outputSanitizer cleans HTML outputs such as pandas tables
+var outputSanitizer = bluemonday.UGCPolicy()
+
+// ansiEscape matches terminal color codes in tracebacks
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// IsNotebook reports whether content is a Jupyter notebook
+func IsNotebook(contentType string, filename string) bool {
+	return strings.Contains(strings.ToLower(contentType), "ipynb") ||
+		strings.EqualFold(filepath.Ext(filename), ".ipynb")
+}
+
+func renderNotebook(content []byte, filename string, rawURL string) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, fmt.Errorf("failed to parse notebook: %w", err)
+	}
+	if nb.NBFormat < 4 {
+		return nil, errors.New("unsupported notebook format")
+	}
+
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.KernelSpec.Language
+	}
+	if language == "" {
+		language = "python"
+	}
+
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		switch cell.CellType {
+		case "markdown":
+			body, err := markdownToHTML([]byte(cell.Source), false)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(`<div class="cell markdown-cell markdown-body">`)
+			b.Write(body)
+			b.WriteString(`</div>`)
+
+		case "code":
+			code, err := highlightSnippet([]byte(cell.Source), language)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(`<div class="cell code-cell">`)
+			fmt.Fprintf(&b, `<div class="prompt">%s</div>`, executionPrompt("In", cell.ExecutionCount))
+			b.WriteString(`<div class="input">`)
+			b.Write(code)
+			b.WriteString(`</div></div>`)
+			for _, output := range cell.Outputs {
+				renderNotebookOutput(&b, output)
+			}
+
+		default: // raw
+			fmt.Fprintf(&b, `<div class="cell raw-cell"><pre>%s</pre></div>`, html.EscapeString(string(cell.Source)))
+		}
+	}
+
+	result := strings.ReplaceAll(notebookPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	// Content last so placeholders inside the notebook are left alone
+	result = strings.Replace(result, "{{CONTENT}}", b.String(), 1)
+
+	return []byte(result), nil
+}
+
+func executionPrompt(label string, count *int) string {
+	if count == nil {
+		return label + " [ ]:"
+	}
+	return fmt.Sprintf("%s [%d]:", label, *count)
+}
+
+// renderNotebookOutput renders a cell output, picking the richest
+// representation that can be shown safely
+func renderNotebookOutput(b *strings.Builder, output notebookOutput) {
+	b.WriteString(`<div class="cell output">`)
+	if output.OutputType == "execute_result" {
+		fmt.Fprintf(b, `<div class="prompt">%s</div>`, executionPrompt("Out", output.ExecutionCount))
+	} else {
+		b.WriteString(`<div class="prompt"></div>`)
+	}
+	b.WriteString(`<div class="output-body">`)
+
+	switch output.OutputType {
+	case "stream":
+		class := "stream"
+		if output.Name == "stderr" {
+			class += " stderr"
+		}
+		fmt.Fprintf(b, `<pre class="%s">%s</pre>`, class, html.EscapeString(string(output.Text)))
+
+	case "error":
+		traceback := output.EName + ": " + output.EValue
+		if len(output.Traceback) > 0 {
+			traceback = ansiEscape.ReplaceAllString(strings.Join(output.Traceback, "\n"), "")
+		}
+		fmt.Fprintf(b, `<pre class="error">%s</pre>`, html.EscapeString(traceback))
+
+	case "execute_result", "display_data":
+		renderNotebookData(b, output.Data)
+	}
+
+	b.WriteString(`</div></div>`)
+}
+
+func renderNotebookData(b *strings.Builder, data map[string]multiline) {
+	// Images are shown as data URIs, SVG included since images cannot run script
+	for _, mimeType := range []string{"image/png", "image/jpeg", "image/gif", "image/svg+xml"} {
+		value, ok := data[mimeType]
+		if !ok {
+			continue
+		}
+
+		var raw []byte
+		if mimeType == "image/svg+xml" {
+			raw = []byte(value)
+		} else {
+			// Re-encode to drop line breaks and reject anything that is not base64
+			var err error
+			raw, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(value)), ""))
+			if err != nil {
+				continue
+			}
+		}
+		fmt.Fprintf(b, `<img src="data:%s;base64,%s" alt="">`, mimeType, base64.StdEncoding.EncodeToString(raw))
+		return
+	}
+
+	if value, ok := data["text/html"]; ok {
+		b.WriteString(`<div class="html-output">`)
+		b.WriteString(outputSanitizer.Sanitize(string(value)))
+		b.WriteString(`</div>`)
+		return
+	}
+
+	if value, ok := data["text/markdown"]; ok {
+		if body, err := markdownToHTML([]byte(value), false); err == nil {
+			b.WriteString(`<div class="markdown-body">`)
+			b.Write(body)
+			b.WriteString(`</div>`)
+			return
+		}
+	}
+
+	if value, ok := data["text/plain"]; ok {
+		fmt.Fprintf(b, `<pre>%s</pre>`, html.EscapeString(string(value)))
+	}
+}
@@ -0,0 +1,157 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LinkPreview locates a share for the OpenGraph and Twitter card tags that
+// chat apps use to unfurl links. All URLs are absolute.
+type LinkPreview struct {
+	URL         string // the share's page
+	RawURL      string // the original file, used as the image or video of media shares
+	ImageURL    string // thumbnail, empty if there is none
+	OEmbedURL   string // oEmbed endpoint describing the share
+	Size        int64  // size of the file, which may be more than is rendered
+	Description string // set by the uploader, used instead of one taken from the content
+}
+
+// maxExcerpt is the length in characters of the description taken from text
+const maxExcerpt = 200
+
+// Excerpt returns the start of a text document as a single line, empty for
+// other content
+func Excerpt(contentType string, content []byte) string {
+	ct := strings.ToLower(contentType)
+	if !strings.HasPrefix(ct, "text/") && !strings.Contains(ct, "markdown") && !strings.Contains(ct, "json") {
+		return ""
+	}
+	if len(content) > 64*1024 {
+		content = content[:64*1024]
+	}
+
+	text := string(content)
+	if strings.Contains(ct, "markdown") {
+		text = markdownText(content)
+	} else if hasANSI(content) {
+		var b strings.Builder
+		for _, line := range parseANSI(text) {
+			for _, run := range line {
+				b.WriteString(run.text)
+			}
+			b.WriteByte('\n')
+		}
+		text = b.String()
+	}
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "")
+	}
+
+	text = strings.Join(strings.FieldsFunc(text, unicode.IsSpace), " ")
+	if utf8.RuneCountInString(text) <= maxExcerpt {
+		return text
+	}
+	runes := []rune(text)[:maxExcerpt]
+	if i := strings.LastIndexByte(string(runes), ' '); i > maxExcerpt/2 {
+		return string(runes)[:i] + "…"
+	}
+	return string(runes) + "…"
+}
+
+// openGraphTags returns the meta tags describing a share, and the oEmbed
+// discovery link
+func openGraphTags(contentType string, content []byte, filename string, p *LinkPreview) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+	size := humanSize(p.Size)
+
+	description := Excerpt(contentType, content)
+	if IsPDF(mediaType, filename) {
+		if info, err := ReadPDFInfo(content); err == nil {
+			description = fmt.Sprintf("PDF document, %d pages", info.Pages)
+			if info.Pages == 1 {
+				description = "PDF document, 1 page"
+			}
+		}
+	}
+	if mediaType == CollectionType {
+		description = ""
+		if c, err := ParseCollection(content); err == nil {
+			description, size = c.Summary(), humanSize(c.Size())
+		}
+	}
+	if p.Description != "" {
+		description = p.Description
+	}
+	if description == "" {
+		description = fmt.Sprintf("%s, %s", mediaType, size)
+	}
+
+	var b strings.Builder
+	meta := func(attr string, name string, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\">\n    ", attr, name, html.EscapeString(value))
+		}
+	}
+
+	meta("property", "og:type", "website")
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:url", p.URL)
+
+	image := p.ImageURL
+	card := "summary"
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		image, card = p.RawURL, "summary_large_image"
+	case strings.HasPrefix(mediaType, "video/"):
+		meta("property", "og:video", p.RawURL)
+		meta("property", "og:video:type", mediaType)
+	case strings.HasPrefix(mediaType, "audio/"):
+		meta("property", "og:audio", p.RawURL)
+		meta("property", "og:audio:type", mediaType)
+	}
+	if image != "" {
+		meta("property", "og:image", image)
+		meta("property", "og:image:alt", title)
+	}
+
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+	// Shown as extra fields by Slack
+	meta("name", "twitter:label1", "Type")
+	meta("name", "twitter:data1", mediaType)
+	meta("name", "twitter:label2", "Size")
+	meta("name", "twitter:data2", size)
+
+	if p.OEmbedURL != "" {
+		fmt.Fprintf(&b, "<link rel=\"alternate\" type=\"application/json+oembed\" href=\"%s\" title=\"%s\">\n    ",
+			html.EscapeString(p.OEmbedURL), html.EscapeString(title))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// withLinkPreview fills in the tags for link unfurling, or removes their
+// placeholder if the share has none. Like the theme, the placeholder precedes
+// all content.
+func withLinkPreview(page []byte, contentType string, content []byte, filename string, p *LinkPreview) []byte {
+	tags := ""
+	if p != nil {
+		tags = openGraphTags(contentType, content, filename, p)
+	}
+	return bytes.Replace(page, []byte("{{META}}"), []byte(tags), 1)
+}
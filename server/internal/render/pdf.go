@@ -0,0 +1,209 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdf.js is not part of the repository, see scripts/fetch-assets.sh. Without
+// it the browser's built-in viewer is used.
+const (
+	pdfjsAsset       = "pdf.min.mjs"
+	pdfjsWorkerAsset = "pdf.worker.min.mjs"
+)
+
+// PDFInfo is the page count and document information of a PDF
+type PDFInfo struct {
+	Pages    int
+	Title    string
+	Author   string
+	Subject  string
+	Keywords string
+	Creator  string // application the document was authored in
+	Producer string // application that wrote the PDF
+	Created  time.Time
+	Modified time.Time
+}
+
+// IsPDF reports whether content is a PDF document
+func IsPDF(contentType string, filename string) bool {
+	return strings.Contains(strings.ToLower(contentType), "application/pdf") ||
+		strings.EqualFold(filepath.Ext(filename), ".pdf")
+}
+
+// openPDF parses a PDF. The parser panics on some malformed or unsupported
+// input, which is reported as an error.
+func openPDF(content []byte) (r *pdf.Reader, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r, err = nil, fmt.Errorf("failed to parse pdf: %v", p)
+		}
+	}()
+
+	r, err = pdf.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pdf: %w", err)
+	}
+	return r, nil
+}
+
+// ReadPDFInfo extracts the page count and metadata of a PDF
+func ReadPDFInfo(content []byte) (info *PDFInfo, err error) {
+	r, err := openPDF(content)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			info, err = nil, fmt.Errorf("failed to read pdf info: %v", p)
+		}
+	}()
+
+	dict := r.Trailer().Key("Info")
+	info = &PDFInfo{
+		Pages:    r.NumPage(),
+		Title:    dict.Key("Title").Text(),
+		Author:   dict.Key("Author").Text(),
+		Subject:  dict.Key("Subject").Text(),
+		Keywords: dict.Key("Keywords").Text(),
+		Creator:  dict.Key("Creator").Text(),
+		Producer: dict.Key("Producer").Text(),
+		Created:  parsePDFDate(dict.Key("CreationDate").Text()),
+		Modified: parsePDFDate(dict.Key("ModDate").Text()),
+	}
+	return info, nil
+}
+
+// ExtractPDFText returns the text of a PDF, page by page, for indexing.
+// Scanned documents without a text layer yield nothing.
+func ExtractPDFText(content []byte) (text string, err error) {
+	r, err := openPDF(content)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			text, err = "", fmt.Errorf("failed to extract pdf text: %v", p)
+		}
+	}()
+
+	var b strings.Builder
+	for i := 1; i <= r.NumPage(); i++ {
+		page := r.Page(i)
+		if page.V.IsNull() {
+			continue
+		}
+		rows, err := page.GetTextByRow()
+		if err != nil {
+			return "", fmt.Errorf("failed to extract pdf text: %w", err)
+		}
+		for _, row := range rows {
+			// Text runs are positioned individually, a gap between them is a space
+			var line strings.Builder
+			for j, run := range row.Content {
+				if j > 0 {
+					prev := row.Content[j-1]
+					if run.X-(prev.X+prev.W) > run.FontSize*0.15 {
+						line.WriteByte(' ')
+					}
+				}
+				line.WriteString(run.S)
+			}
+			b.WriteString(strings.TrimSpace(line.String()))
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\f')
+	}
+	return b.String(), nil
+}
+
+// parsePDFDate parses dates of the form D:YYYYMMDDHHmmSSOHH'mm', where
+// everything after the year is optional
+func parsePDFDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	s = strings.ReplaceAll(s, "'", "")
+
+	layouts := []string{"20060102150405-0700", "20060102150405Z", "20060102150405", "200601021504", "2006010215", "20060102", "200601", "2006"}
+	if strings.HasSuffix(s, "Z") && len(s) > 15 {
+		s = s[:15] + "Z"
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func renderPDF(content []byte, filename string, rawURL string) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	// Damaged or encrypted documents may still open in the viewer
+	details := []string{}
+	var meta strings.Builder
+	info, err := ReadPDFInfo(content)
+	if err == nil {
+		if info.Pages == 1 {
+			details = append(details, "1 page")
+		} else {
+			details = append(details, fmt.Sprintf("%d pages", info.Pages))
+		}
+
+		field := func(name string, value string) {
+			if value != "" {
+				fmt.Fprintf(&meta, `<dt>%s</dt><dd>%s</dd>`, name, html.EscapeString(value))
+			}
+		}
+		date := func(t time.Time) string {
+			if t.IsZero() {
+				return ""
+			}
+			return t.UTC().Format("2006-01-02 15:04")
+		}
+		field("Title", info.Title)
+		field("Author", info.Author)
+		field("Subject", info.Subject)
+		field("Keywords", info.Keywords)
+		field("Created", date(info.Created))
+		field("Modified", date(info.Modified))
+		field("Creator", info.Creator)
+		field("Producer", info.Producer)
+	} else if errors.Is(err, pdf.ErrInvalidPassword) {
+		details = append(details, "encrypted")
+	}
+	details = append(details, humanSize(int64(len(content))))
+
+	metadata := ""
+	if meta.Len() > 0 {
+		metadata = `<details class="pdf-meta"><summary>Document properties</summary><dl>` + meta.String() + `</dl></details>`
+	}
+
+	pdfjsURL, workerURL := "", ""
+	if lib, ok := LookupAsset(pdfjsAsset); ok {
+		if worker, ok := LookupAsset(pdfjsWorkerAsset); ok {
+			pdfjsURL, workerURL = lib.URL(), worker.URL()
+		}
+	}
+
+	result := strings.ReplaceAll(pdfPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{PDFJS_URL}}", html.EscapeString(pdfjsURL))
+	result = strings.ReplaceAll(result, "{{PDFJS_WORKER_URL}}", html.EscapeString(workerURL))
+	result = strings.ReplaceAll(result, "{{DETAILS}}", html.EscapeString(strings.Join(details, " · ")))
+	// Metadata last so placeholders inside document properties are left alone
+	result = strings.Replace(result, "{{METADATA}}", metadata, 1)
+
+	return []byte(result), nil
+}
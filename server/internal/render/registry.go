@@ -0,0 +1,327 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Renderer produces one view of content, such as the table or the code view
+// of a CSV file
+type Renderer interface {
+	// Name identifies the view, as chosen with ?as=
+	Name() string
+
+	// Label is the name of the view shown to viewers
+	Label() string
+
+	// Render converts content to an HTML page, or returns an error if the
+	// content cannot be shown this way. rawURL is where the page links to
+	// the original file.
+	Render(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error)
+
+	// Policy is the Content Security Policy the page needs
+	Policy(opts Options) string
+
+	// Limits declares how much content the view can show
+	Limits() Limits
+}
+
+// Limits declares how much content a view can show
+type Limits struct {
+	// MaxSize is the largest content the view renders, 0 if it has no limit
+	// of its own beyond the server's
+	MaxSize int64
+
+	// NoContent views only link to the file, such as the media player, so
+	// show files of any size without reading them
+	NoContent bool
+
+	// Streams is set for views that can be written as the content is read,
+	// which show the start of files above their limit
+	Streams bool
+}
+
+// Registration selects the content a renderer is offered for
+type Registration struct {
+	// Types are media types, or "image/*" for all of a kind
+	Types []string
+
+	// Extensions are lowercase filename suffixes, e.g. ".csv" or ".tar.gz"
+	Extensions []string
+
+	// Priority orders the views of content, the highest is shown by default
+	Priority int
+}
+
+// matches reports whether content of a type and filename is registered
+func (reg Registration) matches(contentType string, filename string) bool {
+	ct := baseContentType(contentType)
+	for _, t := range reg.Types {
+		if t == ct || strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	name := strings.ToLower(filename)
+	for _, ext := range reg.Extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+type registered struct {
+	renderer Renderer
+	Registration
+}
+
+// registry holds the renderers by descending priority, in order of
+// registration for equal priorities
+var registry []registered
+
+// Register adds a renderer for the content selected by reg. It must be
+// called before serving requests, usually from an init function.
+func Register(r Renderer, reg Registration) {
+	registry = append(registry, registered{r, reg})
+	sort.SliceStable(registry, func(i, j int) bool {
+		return registry[i].Priority > registry[j].Priority
+	})
+}
+
+// Views returns the renderers that can show content of a type and filename,
+// the default view first
+func Views(contentType string, filename string) []Renderer {
+	var views []Renderer
+	seen := map[string]bool{}
+	for _, reg := range registry {
+		if !seen[reg.renderer.Name()] && reg.matches(contentType, filename) {
+			seen[reg.renderer.Name()] = true
+			views = append(views, reg.renderer)
+		}
+	}
+	return views
+}
+
+// RenderWith renders content with the first of views that can show it,
+// returning the view used. Later views are fallbacks, e.g. the code view of
+// a notebook that cannot be parsed.
+func RenderWith(views []Renderer, contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, Renderer, error) {
+	for _, view := range views {
+		page, err := view.Render(contentType, content, filename, rawURL, opts)
+		if err != nil {
+			continue
+		}
+		page = withViews(page, view, opts)
+		page = withRevision(page, opts.Revision)
+		page = withTheme(page, opts.Theme)
+		return withLinkPreview(page, contentType, content, filename, opts.LinkPreview), view, nil
+	}
+	return nil, nil, errors.New("no view can show the content")
+}
+
+// withViews links the other views of the content from the page header,
+// after the title. Titles are escaped, so cannot close the span early.
+func withViews(page []byte, current Renderer, opts Options) []byte {
+	if len(opts.Views) < 2 {
+		return page
+	}
+	header := bytes.Index(page, []byte(`<div class="header">`))
+	if header < 0 {
+		return page
+	}
+	end := bytes.Index(page[header:], []byte("</span>"))
+	if end < 0 {
+		return page
+	}
+	at := header + end + len("</span>")
+
+	var nav strings.Builder
+	nav.WriteString(`<nav class="views" aria-label="Views">`)
+	for _, name := range opts.Views {
+		view := viewByName(name)
+		if view == nil {
+			continue
+		}
+		href := html.EscapeString(opts.ViewURL + "?" + url.Values{"as": {name}}.Encode())
+		if name == current.Name() {
+			fmt.Fprintf(&nav, `<a href="%s" aria-current="page">%s</a>`, href, html.EscapeString(view.Label()))
+		} else {
+			fmt.Fprintf(&nav, `<a href="%s">%s</a>`, href, html.EscapeString(view.Label()))
+		}
+	}
+	nav.WriteString(`</nav>`)
+
+	out := make([]byte, 0, len(page)+nav.Len())
+	out = append(out, page[:at]...)
+	out = append(out, nav.String()...)
+	return append(out, page[at:]...)
+}
+
+// viewByName returns a registered renderer, nil if there is none by the name
+func viewByName(name string) Renderer {
+	for _, reg := range registry {
+		if reg.renderer.Name() == name {
+			return reg.renderer
+		}
+	}
+	return nil
+}
+
+// view is a built-in renderer
+type view struct {
+	name   string
+	label  string
+	csp    string
+	limits Limits
+	render func(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error)
+	policy func(opts Options) string // nil if the page's policy does not depend on the options
+}
+
+func (v *view) Name() string   { return v.name }
+func (v *view) Label() string  { return v.label }
+func (v *view) Limits() Limits { return v.limits }
+
+func (v *view) Render(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+	return v.render(contentType, content, filename, rawURL, opts)
+}
+
+func (v *view) Policy(opts Options) string {
+	if v.policy != nil {
+		return v.policy(opts)
+	}
+	return v.csp
+}
+
+// Built-in views, from the most specific to the code view any text can be
+// shown in
+func init() {
+	Register(&view{
+		name:  "collection",
+		label: "Files",
+		csp:   collectionCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderCollection(content, filename, rawURL)
+		},
+	}, Registration{Types: []string{CollectionType}, Priority: 100})
+
+	Register(&view{
+		name:  "notebook",
+		label: "Notebook",
+		csp:   notebookCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderNotebook(content, filename, rawURL)
+		},
+	}, Registration{Types: []string{"application/x-ipynb+json"}, Extensions: []string{".ipynb"}, Priority: 90})
+
+	Register(&view{
+		name:  "recording",
+		label: "Recording",
+		csp:   castCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderCast(content, filename, rawURL)
+		},
+	}, Registration{Types: []string{"application/x-asciicast"}, Extensions: []string{".cast"}, Priority: 90})
+
+	Register(&view{
+		name:  "markdown",
+		label: "Markdown",
+		render: func(_ string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+			return renderMarkdown(content, filename, rawURL, opts)
+		},
+		policy: func(opts Options) string {
+			if extras := markdownExtras(opts); extras != "" {
+				return pagePolicy(strings.Replace(markdownPage, "{{EXTRAS}}", extras, 1))
+			}
+			return markdownCSP
+		},
+	}, Registration{Types: []string{"text/markdown", "text/x-markdown"}, Extensions: []string{".md", ".markdown"}, Priority: 80})
+
+	Register(&view{
+		name:   "media",
+		label:  "Player",
+		csp:    mediaCSP,
+		limits: Limits{NoContent: true},
+		render: func(contentType string, _ []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderMedia(strings.ToLower(contentType), filename, rawURL)
+		},
+	}, Registration{Types: []string{"video/*", "audio/*"}, Priority: 80})
+
+	Register(&view{
+		name:  "image",
+		label: "Image",
+		csp:   imageCSP,
+		render: func(contentType string, content []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderImage(strings.ToLower(contentType), content, filename, rawURL)
+		},
+	}, Registration{Types: []string{"image/*"}, Priority: 80})
+
+	Register(&view{
+		name:  "table",
+		label: "Table",
+		csp:   tableCSP,
+		render: func(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+			return renderTable(strings.ToLower(contentType), content, filename, rawURL, opts.Table)
+		},
+	}, Registration{Types: []string{"text/csv", "text/tab-separated-values"}, Priority: 80})
+
+	Register(&view{
+		name:  "pdf",
+		label: "Document",
+		csp:   pdfCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, _ Options) ([]byte, error) {
+			return renderPDF(content, filename, rawURL)
+		},
+	}, Registration{Types: []string{"application/pdf"}, Extensions: []string{".pdf"}, Priority: 80})
+
+	Register(&view{
+		name:  "archive",
+		label: "Files",
+		csp:   archiveCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+			return renderArchive(content, filename, rawURL, opts)
+		},
+	}, Registration{
+		Types:      []string{"application/zip", "application/x-zip-compressed", "application/x-tar", "application/x-gtar"},
+		Extensions: []string{".zip", ".tar", ".tar.gz", ".tgz"},
+		Priority:   80,
+	})
+
+	Register(&view{
+		name:  "diff",
+		label: "Diff",
+		csp:   diffCSP,
+		render: func(_ string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+			return renderDiff(content, filename, rawURL, opts.DiffSplit)
+		},
+	}, Registration{Types: []string{"text/x-diff", "text/x-patch"}, Extensions: []string{".diff", ".patch"}, Priority: 80})
+
+	// Logs with terminal colors use the code view's scripts and policy
+	Register(&view{
+		name:   "code",
+		label:  "Code",
+		csp:    codeCSP,
+		limits: Limits{Streams: true},
+		render: renderText,
+	}, Registration{
+		Types:    append([]string{"text/*", "application/x-ipynb+json", "application/x-asciicast"}, codeTypes...),
+		Priority: 0,
+	})
+}
+
+// renderText shows text as a log if it has terminal colors, and as code with
+// syntax highlighting otherwise
+func renderText(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+	// Binary content has no view, it is served as is
+	if IsBinary(content) {
+		return nil, ErrBinary
+	}
+	if strings.HasPrefix(strings.ToLower(contentType), "text/") && hasANSI(content) {
+		return renderLog(content, filename, rawURL)
+	}
+	return renderCode(content, filename, detectLanguage(contentType, filename), rawURL, opts)
+}
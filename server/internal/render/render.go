@@ -2,11 +2,19 @@ package render
 
 import (
 	"bytes"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
 	"html"
 	"path/filepath"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+
+	"github.com/Fileri/share/server/internal/archive"
+	"github.com/Fileri/share/server/internal/imaging"
 )
 
 //go:embed templates/markdown.html
@@ -18,119 +26,268 @@ var codeTemplate string
 //go:embed templates/video.html
 var videoTemplate string
 
-// CanRender returns true if the content type can be rendered
-func CanRender(contentType string) bool {
-	ct := strings.ToLower(contentType)
+//go:embed templates/image.html
+var imageTemplate string
 
-	// Markdown
-	if strings.Contains(ct, "markdown") {
-		return true
-	}
+//go:embed templates/table.html
+var tableTemplate string
 
-	// Code/text files that benefit from syntax highlighting
-	if strings.HasPrefix(ct, "text/") && !strings.Contains(ct, "html") {
-		return true
+//go:embed templates/notebook.html
+var notebookTemplate string
+
+//go:embed templates/diff.html
+var diffTemplate string
+
+//go:embed templates/archive.html
+var archiveTemplate string
+
+//go:embed templates/pdf.html
+var pdfTemplate string
+
+//go:embed templates/log.html
+var logTemplate string
+
+//go:embed templates/cast.html
+var castTemplate string
+
+//go:embed templates/collection.html
+var collectionTemplate string
+
+// Templates with asset placeholders resolved
+var (
+	markdownPage   = withAssets(markdownTemplate)
+	codePage       = withAssets(codeTemplate)
+	mediaPage      = withAssets(videoTemplate)
+	imagePage      = withAssets(imageTemplate)
+	tablePage      = withAssets(tableTemplate)
+	notebookPage   = withAssets(notebookTemplate)
+	diffPage       = withAssets(diffTemplate)
+	archivePage    = withAssets(archiveTemplate)
+	pdfPage        = withAssets(pdfTemplate)
+	logPage        = withAssets(logTemplate)
+	castPage       = withAssets(castTemplate)
+	collectionPage = withAssets(collectionTemplate)
+)
+
+// rendererRevision is bumped whenever a change to the rendering code alters
+// the pages it produces, so cached pages are rendered again
+const rendererRevision = 2
+
+// Version identifies the output of Render, for caching rendered pages. It
+// changes with rendererRevision, the templates, assets and branding, and the
+// commit the server was built from if known.
+func Version() string {
+	return version()
+}
+
+var version = sync.OnceValue(func() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n", rendererRevision)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				fmt.Fprintf(h, "%s=%s\n", s.Key, s.Value)
+			}
+		}
+	}
+	for _, page := range []string{markdownPage, codePage, mediaPage, imagePage, tablePage, notebookPage, diffPage, archivePage, pdfPage, logPage, castPage, collectionPage} {
+		h.Write([]byte(page))
 	}
+	names := make([]string, 0, len(assets))
+	for name := range assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s %s\n", name, assets[name].Version)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+})
+
+// Options controls how content is rendered
+type Options struct {
+	// HighlightMaxSize is the size in bytes above which code is shown
+	// without syntax highlighting, 0 means unlimited
+	HighlightMaxSize int64
+
+	// Table selects the page, sort order and filter of CSV/TSV files
+	Table TableView
+
+	// DiffSplit shows diffs side by side instead of unified
+	DiffSplit bool
+
+	// ArchiveLimits bounds reading zip and tar files, FileURL is the path
+	// prefix their members are linked under
+	ArchiveLimits archive.Limits
+	FileURL       string
+
+	// SiteURL is where archives holding a static site can be viewed as one,
+	// empty if HTML hosting is disabled
+	SiteURL string
+
+	// Diagrams draws mermaid and dot code blocks in Markdown, Math typesets
+	// $...$ and $$...$$ with KaTeX
+	Diagrams bool
+	Math     bool
+
+	// Theme is the color theme of the page, one of ThemeAuto, ThemeLight and
+	// ThemeDark
+	Theme string
+
+	// LinkPreview adds OpenGraph tags for unfurling links to the page, nil
+	// leaves them out
+	LinkPreview *LinkPreview
+
+	// Views are the names of the views of the content, linked from the page
+	// as ViewURL?as=<name> if there is more than one
+	Views   []string
+	ViewURL string
+
+	// Revision notes when the content was replaced, nil for shares that
+	// never were
+	Revision *RevisionNote
+}
 
-	// Video/audio
-	if strings.HasPrefix(ct, "video/") || strings.HasPrefix(ct, "audio/") {
-		return true
+// CanRender returns true if the content type has a view. HTML is shown as
+// code only on request, pages are served as such.
+func CanRender(contentType string) bool {
+	ct := baseContentType(contentType)
+	if ct == "text/html" || ct == "application/xhtml+xml" {
+		return false
 	}
+	return len(Views(ct, "")) > 0
+}
 
-	// Common code types
-	codeTypes := []string{
-		"application/json",
-		"application/javascript",
-		"application/typescript",
-		"application/x-yaml",
-		"application/xml",
+// codeTypes are types outside of text/* that are shown as code
+var codeTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/typescript",
+	"application/x-yaml",
+	"application/xml",
+}
+
+// IsText reports whether content is text shown in a rendered view, such as
+// code, logs and Markdown
+func IsText(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	if strings.HasPrefix(ct, "text/") {
+		return !strings.Contains(ct, "html")
+	}
+	if strings.Contains(ct, "markdown") || strings.Contains(ct, "ipynb") || IsCast(ct, "") {
+		return true
 	}
 	for _, t := range codeTypes {
 		if strings.Contains(ct, t) {
 			return true
 		}
 	}
-
 	return false
 }
 
-// Render converts content to HTML for browser display
-func Render(contentType string, content []byte, filename string, id string) ([]byte, error) {
-	ct := strings.ToLower(contentType)
+// Render converts content to HTML for browser display with its default view,
+// or the next that can show it. rawURL is where the page links to the
+// original file.
+func Render(contentType string, content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+	page, _, err := RenderWith(Views(contentType, filename), contentType, content, filename, rawURL, opts)
+	return page, err
+}
 
-	// Markdown
-	if strings.Contains(ct, "markdown") {
-		return renderMarkdown(content, filename, id)
+func renderMarkdown(content []byte, filename string, rawURL string, opts Options) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
 	}
 
-	// Video/audio
-	if strings.HasPrefix(ct, "video/") || strings.HasPrefix(ct, "audio/") {
-		return renderMedia(ct, filename, id)
+	body, err := markdownToHTML(content, opts.Math)
+	if err != nil {
+		return nil, err
 	}
 
-	// Everything else as code with syntax highlighting
-	return renderCode(content, filename, detectLanguage(contentType, filename), id)
+	result := strings.ReplaceAll(markdownPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{EXTRAS}}", markdownExtras(opts))
+	// Content last so placeholders inside the document are left alone
+	result = strings.Replace(result, "{{CONTENT}}", string(body), 1)
+
+	return []byte(result), nil
 }
 
-func renderMarkdown(content []byte, filename string, id string) ([]byte, error) {
+func renderMedia(contentType string, filename string, rawURL string) ([]byte, error) {
 	title := filename
 	if title == "" {
 		title = "Shared Content"
 	}
 
-	// Escape content for embedding in JavaScript template literal
-	escaped := escapeForJSTemplateLiteral(string(content))
+	var player string
+	if strings.HasPrefix(contentType, "video/") {
+		player = fmt.Sprintf(`<video controls autoplay preload="auto"><source src="%s" type="%s">Your browser does not support video playback.</video>`, html.EscapeString(rawURL), html.EscapeString(contentType))
+	} else {
+		player = fmt.Sprintf(`<audio controls preload="auto"><source src="%s" type="%s">Your browser does not support audio playback.</audio>`, html.EscapeString(rawURL), html.EscapeString(contentType))
+	}
 
-	result := strings.ReplaceAll(markdownTemplate, "{{TITLE}}", html.EscapeString(title))
-	result = strings.ReplaceAll(result, "{{CONTENT}}", escaped)
-	result = strings.ReplaceAll(result, "{{ID}}", id)
+	result := strings.ReplaceAll(mediaPage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{PLAYER}}", player)
 
 	return []byte(result), nil
 }
 
-func renderMedia(contentType string, filename string, id string) ([]byte, error) {
+func renderImage(contentType string, content []byte, filename string, rawURL string) ([]byte, error) {
 	title := filename
 	if title == "" {
 		title = "Shared Content"
 	}
 
-	rawURL := id + "/raw"
-	var player string
-	if strings.HasPrefix(contentType, "video/") {
-		player = fmt.Sprintf(`<video controls autoplay preload="auto"><source src="%s" type="%s">Your browser does not support video playback.</video>`, rawURL, contentType)
-	} else {
-		player = fmt.Sprintf(`<audio controls preload="auto"><source src="%s" type="%s">Your browser does not support audio playback.</audio>`, rawURL, contentType)
+	// Dimensions are unknown for formats without a decoder, e.g. SVG
+	details := []string{}
+	if width, height, ok := imaging.Dimensions(content); ok {
+		details = append(details, fmt.Sprintf("%d × %d px", width, height))
+	}
+	details = append(details, humanSize(int64(len(content))))
+	// Format name from the subtype, e.g. "image/svg+xml" -> "SVG"
+	subtype, _, _ := strings.Cut(strings.TrimPrefix(contentType, "image/"), ";")
+	subtype, _, _ = strings.Cut(subtype, "+")
+	if subtype = strings.TrimPrefix(strings.TrimSpace(subtype), "x-"); subtype != "" {
+		details = append(details, strings.ToUpper(subtype))
 	}
 
-	result := strings.ReplaceAll(videoTemplate, "{{TITLE}}", html.EscapeString(title))
-	result = strings.ReplaceAll(result, "{{ID}}", id)
-	result = strings.ReplaceAll(result, "{{PLAYER}}", player)
+	result := strings.ReplaceAll(imagePage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{DETAILS}}", html.EscapeString(strings.Join(details, " · ")))
 
 	return []byte(result), nil
 }
 
-// escapeForJSTemplateLiteral escapes content for safe embedding in JS template literals
-func escapeForJSTemplateLiteral(s string) string {
-	// Escape backslashes first, then backticks, then ${
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "`", "\\`")
-	s = strings.ReplaceAll(s, "${", "\\${")
-	return s
+// humanSize formats a byte count for display, e.g. "1.5 MB"
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
-func renderCode(content []byte, filename string, language string, id string) ([]byte, error) {
+func renderCode(content []byte, filename string, language string, rawURL string, opts Options) ([]byte, error) {
 	title := filename
 	if title == "" {
 		title = "Shared Content"
 	}
 
-	// Escape content for embedding in HTML
-	escaped := html.EscapeString(string(content))
+	highlighted, err := highlight(content, filename, language, opts.HighlightMaxSize)
+	if err != nil {
+		return nil, err
+	}
 
-	result := strings.ReplaceAll(codeTemplate, "{{TITLE}}", html.EscapeString(title))
-	result = strings.ReplaceAll(result, "{{LANGUAGE}}", language)
-	result = strings.ReplaceAll(result, "{{CONTENT}}", escaped)
-	result = strings.ReplaceAll(result, "{{ID}}", id)
+	result := strings.ReplaceAll(codePage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	// Content last so placeholders inside the code are left alone
+	result = strings.Replace(result, "{{CONTENT}}", string(highlighted), 1)
 
 	return []byte(result), nil
 }
@@ -232,7 +389,7 @@ func detectLanguage(contentType string, filename string) string {
 		}
 	}
 
-	// Default - let highlight.js auto-detect
+	// Default - let the highlighter detect from content
 	return ""
 }
 
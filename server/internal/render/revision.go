@@ -0,0 +1,56 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"time"
+)
+
+// RevisionNote describes which version of a replaced share a page shows
+type RevisionNote struct {
+	Number  int       // the version shown, counting the original upload as 1
+	Updated time.Time // when the version was stored
+	Latest  bool      // the current version rather than a previous one
+
+	// LinkURL is the previous version from the latest one, and the latest
+	// from previous ones, empty to link neither
+	LinkURL string
+}
+
+// withRevision notes below the page header when the content was last
+// replaced, or which previous version the page shows
+func withRevision(page []byte, note *RevisionNote) []byte {
+	if note == nil {
+		return page
+	}
+	header := bytes.Index(page, []byte(`<div class="header">`))
+	if header < 0 {
+		return page
+	}
+	end := bytes.Index(page[header:], []byte("</div>"))
+	if end < 0 {
+		return page
+	}
+	at := header + end + len("</div>")
+
+	when := fmt.Sprintf(`<time datetime="%s">%s</time>`,
+		note.Updated.UTC().Format(time.RFC3339), note.Updated.UTC().Format("2 Jan 2006 15:04 UTC"))
+	var text string
+	if note.Latest {
+		text = "Last updated " + when
+		if note.LinkURL != "" {
+			text += fmt.Sprintf(` · <a href="%s">Previous version</a>`, html.EscapeString(note.LinkURL))
+		}
+	} else {
+		text = fmt.Sprintf("Version %d from %s", note.Number, when)
+		if note.LinkURL != "" {
+			text += fmt.Sprintf(` · <a href="%s">Latest version</a>`, html.EscapeString(note.LinkURL))
+		}
+	}
+
+	out := make([]byte, 0, len(page)+len(text)+64)
+	out = append(out, page[:at]...)
+	out = append(out, `<p class="revision-note">`+text+`</p>`...)
+	return append(out, page[at:]...)
+}
@@ -0,0 +1,103 @@
+package render
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// streamBuffer is the size lines are read in, longer lines are written in
+// pieces
+const streamBuffer = 64 * 1024
+
+// ErrBinary is returned by StreamText for content that is not text, before
+// anything is written
+var ErrBinary = errors.New("binary content")
+
+// StreamText writes the code view of text read from r, or the log view if it
+// has terminal colors, as the text is read. Lines are not highlighted. If
+// maxLines is non-zero, only the first lines are shown below a note that the
+// file is too large to show in full, size is that of the whole file. The
+// other views in opts are linked as current's alternatives.
+func StreamText(w io.Writer, current Renderer, contentType string, r io.Reader, size int64, filename string, rawURL string, maxLines int, opts Options) error {
+	in := bufio.NewReaderSize(r, streamBuffer)
+	// An error here is also returned when reading below
+	head, _ := in.Peek(streamBuffer)
+	if IsBinary(head) {
+		return ErrBinary
+	}
+
+	isLog := strings.HasPrefix(strings.ToLower(contentType), "text/") && hasANSI(head)
+	page := codePage
+	if isLog {
+		page = logPage
+	}
+
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	top, bottom, _ := strings.Cut(page, "{{CONTENT}}")
+	top = strings.ReplaceAll(top, "{{TITLE}}", html.EscapeString(title))
+	top = strings.ReplaceAll(top, "{{RAW_URL}}", html.EscapeString(rawURL))
+	header := withViews([]byte(top), current, opts)
+	header = withRevision(header, opts.Revision)
+	header = withTheme(header, opts.Theme)
+	header = withLinkPreview(header, contentType, head, filename, opts.LinkPreview)
+
+	out := bufio.NewWriter(w)
+	out.Write(header)
+	if maxLines > 0 {
+		fmt.Fprintf(out, `<p class="truncated">This file is too large to show in full (%s), these are its first %d lines. <a href="%s">View raw</a></p>`,
+			humanSize(size), maxLines, html.EscapeString(rawURL))
+	}
+	out.WriteString(`<pre tabindex="0" class="chroma"><code>`)
+
+	// The number of lines is not known up front, the size bounds it
+	digits := len(strconv.FormatInt(size, 10))
+	if maxLines > 0 {
+		digits = len(strconv.Itoa(maxLines))
+	}
+
+	ansi := newANSIParser()
+	n := 0
+	inLine := false
+	for {
+		chunk, more, err := in.ReadLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+
+		if !inLine {
+			n++
+			if maxLines > 0 && n > maxLines {
+				break
+			}
+			writeLineStart(out, n, digits)
+		}
+		if isLog {
+			writeANSIRuns(out, ansi.line(string(chunk)))
+		} else {
+			out.WriteString(html.EscapeString(string(chunk)))
+		}
+		inLine = more
+		if !inLine {
+			out.WriteString(lineEnd)
+		}
+	}
+	if inLine {
+		out.WriteString(lineEnd)
+	}
+
+	out.WriteString(`</code></pre>`)
+	out.WriteString(bottom)
+	return out.Flush()
+}
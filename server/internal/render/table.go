@@ -0,0 +1,385 @@
+package render
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// tableRowsPerPage is the number of rows shown on one page of a table
+const tableRowsPerPage = 100
+
+// delimiters are the candidates tried when sniffing a CSV file
+var delimiters = []rune{',', ';', '\t', '|'}
+
+// TableView selects the rows of a table to show
+type TableView struct {
+	Page   int    // 1-based
+	Sort   int    // column index, -1 to keep file order
+	Desc   bool   // sort descending
+	Filter string // case-insensitive text rows must contain
+}
+
+// table is a parsed CSV/TSV file
+type table struct {
+	header []string // nil if the file has no header row
+	rows   [][]string
+	width  int // number of columns of the widest row
+}
+
+// IsTable reports whether the content type is rendered as a table
+func IsTable(contentType string) bool {
+	ct := baseContentType(contentType)
+	return ct == "text/csv" || ct == "text/tab-separated-values"
+}
+
+func baseContentType(contentType string) string {
+	ct, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	return strings.TrimSpace(ct)
+}
+
+// parseTable reads a CSV or TSV file, detecting its delimiter and header row
+func parseTable(contentType string, content []byte) (*table, error) {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+
+	delimiter := '\t'
+	if baseContentType(contentType) != "text/tab-separated-values" {
+		delimiter = sniffDelimiter(content)
+	}
+
+	r := csv.NewReader(bytes.NewReader(content))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse table: %w", err)
+	}
+
+	t := &table{rows: records}
+	if hasHeader(records) {
+		t.header, t.rows = records[0], records[1:]
+	}
+	for _, row := range records {
+		t.width = max(t.width, len(row))
+	}
+	return t, nil
+}
+
+// sniffDelimiter picks the delimiter that splits the first lines into the
+// same number of columns most consistently
+func sniffDelimiter(content []byte) rune {
+	sample := content
+	if len(sample) > 16*1024 {
+		sample = sample[:16*1024]
+		if i := bytes.LastIndexByte(sample, '\n'); i > 0 {
+			sample = sample[:i]
+		}
+	}
+
+	best, bestScore := ',', 0
+	for _, d := range delimiters {
+		r := csv.NewReader(bytes.NewReader(sample))
+		r.Comma = d
+		r.FieldsPerRecord = -1
+		r.LazyQuotes = true
+
+		counts := map[int]int{}
+		for i := 0; i < 20; i++ {
+			record, err := r.Read()
+			if err != nil {
+				break
+			}
+			counts[len(record)]++
+		}
+
+		// Score by the most common column count among rows agreeing on it
+		for columns, rows := range counts {
+			if columns > 1 && rows*columns > bestScore {
+				best, bestScore = d, rows*columns
+			}
+		}
+	}
+	return best
+}
+
+// hasHeader guesses whether the first row holds column names: all cells are
+// set, distinct and not numbers
+func hasHeader(records [][]string) bool {
+	if len(records) < 2 {
+		return false
+	}
+
+	seen := map[string]bool{}
+	for _, cell := range records[0] {
+		cell = strings.TrimSpace(cell)
+		if cell == "" || seen[cell] || isNumber(cell) {
+			return false
+		}
+		seen[cell] = true
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return err == nil
+}
+
+// selectRows returns the rows matching the view's filter, in its sort order
+func (t *table) selectRows(view TableView) [][]string {
+	rows := t.rows
+
+	if view.Filter != "" {
+		filter := strings.ToLower(view.Filter)
+		rows = nil
+		for _, row := range t.rows {
+			for _, cell := range row {
+				if strings.Contains(strings.ToLower(cell), filter) {
+					rows = append(rows, row)
+					break
+				}
+			}
+		}
+	}
+
+	if view.Sort >= 0 && view.Sort < t.width {
+		rows = append([][]string(nil), rows...)
+		col := view.Sort
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := cellAt(rows[i], col), cellAt(rows[j], col)
+			if view.Desc {
+				a, b = b, a
+			}
+			return compareCells(a, b) < 0
+		})
+	}
+
+	return rows
+}
+
+func cellAt(row []string, col int) string {
+	if col < len(row) {
+		return row[col]
+	}
+	return ""
+}
+
+// compareCells orders numbers numerically and everything else as text
+func compareCells(a, b string) int {
+	x, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	y, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	switch {
+	case errA == nil && errB == nil:
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1 // numbers before text
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+// columnName returns the header of a column, or a spreadsheet-style letter
+func (t *table) columnName(col int) string {
+	if col < len(t.header) && strings.TrimSpace(t.header[col]) != "" {
+		return t.header[col]
+	}
+
+	name := ""
+	for n := col + 1; n > 0; n = (n - 1) / 26 {
+		name = string(rune('A'+(n-1)%26)) + name
+	}
+	return name
+}
+
+func renderTable(contentType string, content []byte, filename string, rawURL string, view TableView) ([]byte, error) {
+	title := filename
+	if title == "" {
+		title = "Shared Content"
+	}
+
+	t, err := parseTable(contentType, content)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := t.selectRows(view)
+	pages := max(1, (len(rows)+tableRowsPerPage-1)/tableRowsPerPage)
+	page := min(max(view.Page, 1), pages)
+	start := (page - 1) * tableRowsPerPage
+	end := min(start+tableRowsPerPage, len(rows))
+
+	var b strings.Builder
+	b.WriteString(`<table class="data-table"><thead><tr>`)
+	for col := 0; col < t.width; col++ {
+		// Clicking a column sorts ascending, clicking it again flips the order
+		next := TableView{Sort: col, Filter: view.Filter}
+		indicator := ""
+		if view.Sort == col {
+			next.Desc = !view.Desc
+			indicator = " ▲"
+			if view.Desc {
+				indicator = " ▼"
+			}
+		}
+		fmt.Fprintf(&b, `<th><a href="%s">%s%s</a></th>`,
+			html.EscapeString(next.query("")), html.EscapeString(t.columnName(col)), indicator)
+	}
+	b.WriteString(`</tr></thead><tbody>`)
+	for _, row := range rows[start:end] {
+		b.WriteString("<tr>")
+		for col := 0; col < t.width; col++ {
+			cell := cellAt(row, col)
+			if isNumber(cell) {
+				b.WriteString(`<td class="num">`)
+			} else {
+				b.WriteString("<td>")
+			}
+			b.WriteString(html.EscapeString(cell))
+			b.WriteString("</td>")
+		}
+		b.WriteString("</tr>")
+	}
+	b.WriteString(`</tbody></table>`)
+
+	summary := fmt.Sprintf("%d rows", len(rows))
+	if len(rows) > 0 {
+		summary = fmt.Sprintf("Rows %d–%d of %d", start+1, end, len(rows))
+	}
+	if view.Filter != "" {
+		summary += fmt.Sprintf(" matching (%d total)", len(t.rows))
+	}
+
+	var pager strings.Builder
+	if page > 1 {
+		prev := view
+		prev.Page = page - 1
+		fmt.Fprintf(&pager, `<a href="%s">← Previous</a>`, html.EscapeString(prev.query("")))
+	}
+	fmt.Fprintf(&pager, `<span>Page %d of %d</span>`, page, pages)
+	if page < pages {
+		next := view
+		next.Page = page + 1
+		fmt.Fprintf(&pager, `<a href="%s">Next →</a>`, html.EscapeString(next.query("")))
+	}
+
+	sortField := ""
+	if view.Sort >= 0 {
+		sortField = fmt.Sprintf(`<input type="hidden" name="sort" value="%d">`, view.Sort)
+		if view.Desc {
+			sortField += `<input type="hidden" name="order" value="desc">`
+		}
+	}
+
+	result := strings.ReplaceAll(tablePage, "{{TITLE}}", html.EscapeString(title))
+	result = strings.ReplaceAll(result, "{{RAW_URL}}", html.EscapeString(rawURL))
+	result = strings.ReplaceAll(result, "{{SUMMARY}}", html.EscapeString(summary))
+	result = strings.ReplaceAll(result, "{{FILTER}}", html.EscapeString(view.Filter))
+	result = strings.ReplaceAll(result, "{{SORT_FIELD}}", sortField)
+	result = strings.ReplaceAll(result, "{{PAGER}}", pager.String())
+	result = strings.ReplaceAll(result, "{{CSV_URL}}", html.EscapeString(view.query("csv")))
+	result = strings.ReplaceAll(result, "{{JSON_URL}}", html.EscapeString(view.query("json")))
+	// Content last so placeholders inside the cells are left alone
+	result = strings.Replace(result, "{{CONTENT}}", b.String(), 1)
+
+	return []byte(result), nil
+}
+
+// query encodes the view as a relative URL, optionally as a download format
+func (v TableView) query(format string) string {
+	q := url.Values{}
+	if v.Sort >= 0 {
+		q.Set("sort", strconv.Itoa(v.Sort))
+		if v.Desc {
+			q.Set("order", "desc")
+		}
+	}
+	if v.Filter != "" {
+		q.Set("q", v.Filter)
+	}
+	if format != "" {
+		q.Set("format", format)
+	} else if v.Page > 1 {
+		q.Set("page", strconv.Itoa(v.Page))
+	}
+	return "?" + q.Encode()
+}
+
+// ParseTableView reads the page, sort order and filter from query params
+func ParseTableView(q url.Values) TableView {
+	view := TableView{Page: 1, Sort: -1, Filter: q.Get("q")}
+	if page, err := strconv.Atoi(q.Get("page")); err == nil {
+		view.Page = page
+	}
+	if col, err := strconv.Atoi(q.Get("sort")); err == nil && col >= 0 {
+		view.Sort = col
+		view.Desc = q.Get("order") == "desc"
+	}
+	return view
+}
+
+// ExportTable converts the rows selected by a view to CSV or JSON. JSON is
+// an array of objects keyed by column name if the file has a header row,
+// otherwise an array of arrays.
+func ExportTable(contentType string, content []byte, view TableView, format string) ([]byte, error) {
+	t, err := parseTable(contentType, content)
+	if err != nil {
+		return nil, err
+	}
+	rows := t.selectRows(view)
+
+	switch format {
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if t.header != nil {
+			w.Write(t.header)
+		}
+		w.WriteAll(rows)
+		if err := w.Error(); err != nil {
+			return nil, fmt.Errorf("failed to write CSV: %w", err)
+		}
+		return buf.Bytes(), nil
+
+	case "json":
+		if t.header == nil {
+			return json.Marshal(rows)
+		}
+		// Written by hand to keep keys in column order
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, row := range rows {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte('{')
+			for col := 0; col < t.width; col++ {
+				if col > 0 {
+					buf.WriteByte(',')
+				}
+				key, _ := json.Marshal(t.columnName(col))
+				value, _ := json.Marshal(cellAt(row, col))
+				buf.Write(key)
+				buf.WriteByte(':')
+				buf.Write(value)
+			}
+			buf.WriteByte('}')
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("unsupported table format %q", format)
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Color themes of the rendered views. Auto follows the viewer's
+// prefers-color-scheme setting.
+const (
+	ThemeAuto  = "auto"
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+// ValidTheme reports whether name is one of the themes
+func ValidTheme(name string) bool {
+	return name == ThemeAuto || name == ThemeLight || name == ThemeDark
+}
+
+// cssRule matches the selector of a rule written on one line, after an
+// optional comment
+var cssRule = regexp.MustCompile(`(?m)^(/\*[^*]*\*/ )?([^@{}\s][^{}\n]*)\{`)
+
+// forTheme scopes the rules of a stylesheet to pages shown in the given
+// theme, whether set explicitly or through auto and the system preference
+func forTheme(css string, theme string) string {
+	scoped := func(scope string) string {
+		return cssRule.ReplaceAllString(css, "${1}"+scope+" ${2}{")
+	}
+	return scoped(`html[data-theme="`+theme+`"]`) +
+		"@media (prefers-color-scheme: " + theme + ") {\n" + scoped(`html[data-theme="auto"]`) + "}\n"
+}
+
+// brandingAsset is the stylesheet holding the operator's logo and custom CSS
+const brandingAsset = "branding.css"
+
+// logoNames are the logo files looked for in the branding directory
+var logoNames = []string{"logo.svg", "logo.png", "logo.webp", "logo.jpg", "logo.jpeg", "logo.gif"}
+
+// brandingTag links the branding stylesheet into every page, empty if none
+// is configured
+var brandingTag string
+
+// LoadBranding adds custom.css and a logo from dir to every rendered view.
+// Either file may be missing. It must be called before serving requests.
+func LoadBranding(dir string) error {
+	var css strings.Builder
+	css.WriteString("/* Branding, generated at startup */\n")
+
+	for _, name := range logoNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read logo: %w", err)
+		}
+
+		logo := newAsset(name, data)
+		assets[name] = logo
+		fmt.Fprintf(&css, `.header::before {
+    content: "";
+    flex: none;
+    width: 120px;
+    height: 28px;
+    margin-right: 12px;
+    background: url(%s) left center / contain no-repeat;
+}
+.header > :first-child {
+    margin-right: auto;
+}
+`, logo.URL())
+		break
+	}
+
+	custom, err := os.ReadFile(filepath.Join(dir, "custom.css"))
+	switch {
+	case err == nil:
+		css.Write(bytes.TrimSpace(custom))
+		css.WriteByte('\n')
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("failed to read custom css: %w", err)
+	}
+
+	branding := newAsset(brandingAsset, []byte(css.String()))
+	assets[brandingAsset] = branding
+	brandingTag = assetTag(branding)
+	return nil
+}
+
+// withTheme sets the theme of a rendered page and links the branding. The
+// placeholders precede all content, so only the first of each is replaced.
+func withTheme(page []byte, theme string) []byte {
+	if !ValidTheme(theme) {
+		theme = ThemeDark
+	}
+	page = bytes.Replace(page, []byte("{{THEME}}"), []byte(theme), 1)
+	return bytes.Replace(page, []byte("{{BRANDING}}"), []byte(brandingTag), 1)
+}
@@ -2,17 +2,26 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 )
 
 // Filesystem implements Storage using the local filesystem
 type Filesystem struct {
 	basePath string
+
+	// metaMu is held while metadata of an existing item is replaced or
+	// removed, so an update never brings back a deleted item
+	metaMu sync.Mutex
 }
 
 // NewFilesystem creates a new filesystem storage backend
@@ -22,8 +31,9 @@ func NewFilesystem(basePath string) (*Filesystem, error) {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
-	// Create subdirectories for data and metadata
-	for _, sub := range []string{"files", "meta"} {
+	// Create subdirectories for data, metadata, derived artifacts, WebDAV locks
+	// and resumable uploads
+	for _, sub := range []string{"files", "meta", "derived", "locks", "uploads"} {
 		if err := os.MkdirAll(filepath.Join(basePath, sub), 0755); err != nil {
 			return nil, fmt.Errorf("failed to create %s directory: %w", sub, err)
 		}
@@ -40,39 +50,109 @@ func (f *Filesystem) metaPath(id string) string {
 	return filepath.Join(f.basePath, "meta", id+".json")
 }
 
+func (f *Filesystem) derivedPath(id string, name string) string {
+	return filepath.Join(f.basePath, "derived", id, name)
+}
+
 // Put stores a file and its metadata
 func (f *Filesystem) Put(ctx context.Context, id string, content io.Reader, item *Item) error {
-	// Write file content
-	file, err := os.Create(f.filePath(id))
+	// Write file content to a temporary file first, so content replaced
+	// under the same ID is never read half-written
+	file, err := os.CreateTemp(filepath.Join(f.basePath, "files"), ".tmp-*")
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
+	defer os.Remove(file.Name())
 
-	size, err := io.Copy(file, content)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if err == nil {
+		err = file.Close()
+	} else {
+		file.Close()
+	}
 	if err != nil {
-		os.Remove(f.filePath(id))
 		return fmt.Errorf("failed to write file: %w", err)
 	}
+
+	// Content replaced under the same ID is kept aside until the new
+	// metadata is stored, and put back if it can't be
+	previous := file.Name() + ".previous"
+	replacing := os.Link(f.filePath(id), previous) == nil
+	if replacing {
+		defer os.Remove(previous)
+	}
+
+	if err := os.Rename(file.Name(), f.filePath(id)); err != nil {
+		return fmt.Errorf("failed to store file: %w", err)
+	}
 	item.Size = size
+	item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := f.writeMeta(id, item); err != nil {
+		if replacing {
+			os.Rename(previous, f.filePath(id))
+		} else {
+			os.Remove(f.filePath(id))
+		}
+		return err
+	}
 
-	// Write metadata
-	metaFile, err := os.Create(f.metaPath(id))
+	return nil
+}
+
+// writeMeta atomically replaces the metadata of an item, so it is never read
+// half-written
+func (f *Filesystem) writeMeta(id string, item *Item) error {
+	tmp, err := os.CreateTemp(filepath.Join(f.basePath, "meta"), ".tmp-*")
 	if err != nil {
-		os.Remove(f.filePath(id))
 		return fmt.Errorf("failed to create metadata file: %w", err)
 	}
-	defer metaFile.Close()
+	defer os.Remove(tmp.Name())
 
-	if err := json.NewEncoder(metaFile).Encode(item); err != nil {
-		os.Remove(f.filePath(id))
-		os.Remove(f.metaPath(id))
+	if err := json.NewEncoder(tmp).Encode(item); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
+	if err := os.Rename(tmp.Name(), f.metaPath(id)); err != nil {
+		return fmt.Errorf("failed to store metadata: %w", err)
+	}
+	return nil
+}
 
+// UpdateMeta replaces the metadata of an existing item
+func (f *Filesystem) UpdateMeta(ctx context.Context, id string, item *Item) error {
+	f.metaMu.Lock()
+	defer f.metaMu.Unlock()
+
+	info, err := os.Stat(f.metaPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("item not found")
+		}
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if item.version != "" && item.version != metaVersion(info) {
+		return ErrItemChanged
+	}
+	if err := f.writeMeta(id, item); err != nil {
+		return err
+	}
+	if info, err := os.Stat(f.metaPath(id)); err == nil {
+		item.version = metaVersion(info)
+	}
 	return nil
 }
 
+// metaVersion identifies a metadata file as written, which is replaced as a
+// whole on every change
+func metaVersion(info os.FileInfo) string {
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size())
+}
+
 // Get retrieves a file and its metadata
 func (f *Filesystem) Get(ctx context.Context, id string) (io.ReadCloser, *Item, error) {
 	item, err := f.GetMeta(ctx, id)
@@ -102,19 +182,75 @@ func (f *Filesystem) GetMeta(ctx context.Context, id string) (*Item, error) {
 	}
 	defer metaFile.Close()
 
+	info, err := metaFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
 	var item Item
 	if err := json.NewDecoder(metaFile).Decode(&item); err != nil {
 		return nil, fmt.Errorf("failed to read metadata: %w", err)
 	}
+	item.version = metaVersion(info)
 
 	return &item, nil
 }
 
-// Delete removes a file and its metadata
+// Delete removes a file, its metadata and derived artifacts
 func (f *Filesystem) Delete(ctx context.Context, id string) error {
-	// Remove both files, ignore errors if they don't exist
-	os.Remove(f.filePath(id))
+	// Remove everything, ignore errors if they don't exist
+	f.metaMu.Lock()
 	os.Remove(f.metaPath(id))
+	f.metaMu.Unlock()
+	os.Remove(f.filePath(id))
+	os.RemoveAll(filepath.Join(f.basePath, "derived", id))
+	return nil
+}
+
+// PutDerived stores an artifact generated from an item
+func (f *Filesystem) PutDerived(ctx context.Context, id string, name string, content io.Reader) error {
+	path := f.derivedPath(id, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create derived directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial artifact
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create derived file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write derived file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write derived file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store derived file: %w", err)
+	}
+	return nil
+}
+
+// GetDerived retrieves an artifact generated from an item
+func (f *Filesystem) GetDerived(ctx context.Context, id string, name string) (io.ReadCloser, error) {
+	file, err := os.Open(f.derivedPath(id, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("derived file not found")
+		}
+		return nil, fmt.Errorf("failed to open derived file: %w", err)
+	}
+	return file, nil
+}
+
+// DeleteDerived removes an artifact generated from an item
+func (f *Filesystem) DeleteDerived(ctx context.Context, id string, name string) error {
+	if err := os.Remove(f.derivedPath(id, name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete derived file: %w", err)
+	}
 	return nil
 }
 
@@ -151,3 +287,255 @@ func (f *Filesystem) List(ctx context.Context, ownerToken string) ([]*Item, erro
 
 	return items, nil
 }
+
+func (f *Filesystem) lockPath(root string) string {
+	return filepath.Join(f.basePath, "locks", lockKey(root)+".json")
+}
+
+// writeLockTemp writes a lock to a temporary file next to its final location
+func (f *Filesystem) writeLockTemp(lock *Lock) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Join(f.basePath, "locks"), ".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create lock file: %w", err)
+	}
+	defer tmp.Close()
+
+	if err := json.NewEncoder(tmp).Encode(lock); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write lock: %w", err)
+	}
+	return tmp.Name(), nil
+}
+
+// CreateLock stores a new lock. The lock file is linked into place so that
+// creation is atomic and fails if another process holds the same root.
+func (f *Filesystem) CreateLock(ctx context.Context, lock *Lock) error {
+	tmp, err := f.writeLockTemp(lock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := os.Link(tmp, f.lockPath(lock.Root)); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return ErrLockExists
+		}
+		return fmt.Errorf("failed to create lock: %w", err)
+	}
+	return nil
+}
+
+// UpdateLock atomically replaces an existing lock
+func (f *Filesystem) UpdateLock(ctx context.Context, lock *Lock) error {
+	tmp, err := f.writeLockTemp(lock)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, f.lockPath(lock.Root)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to update lock: %w", err)
+	}
+	return nil
+}
+
+// DeleteLock removes a lock if it is still stored with the same token. The
+// lock file is moved aside to be checked, so a lock taken on the root in
+// between, also by another process, is put back rather than removed.
+func (f *Filesystem) DeleteLock(ctx context.Context, lock *Lock) error {
+	aside, err := os.CreateTemp(filepath.Join(f.basePath, "locks"), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create lock file: %w", err)
+	}
+	aside.Close()
+	defer os.Remove(aside.Name())
+
+	if err := os.Rename(f.lockPath(lock.Root), aside.Name()); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete lock: %w", err)
+	}
+
+	var stored Lock
+	if data, err := os.ReadFile(aside.Name()); err == nil && json.Unmarshal(data, &stored) == nil && stored.Token != lock.Token {
+		// The root was locked again since, and that lock is put back
+		if err := os.Link(aside.Name(), f.lockPath(lock.Root)); err != nil && !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to restore lock: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListLocks returns all stored locks
+func (f *Filesystem) ListLocks(ctx context.Context) ([]*Lock, error) {
+	lockDir := filepath.Join(f.basePath, "locks")
+	entries, err := os.ReadDir(lockDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock directory: %w", err)
+	}
+
+	var locks []*Lock
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(lockDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		var lock Lock
+		if err := json.Unmarshal(data, &lock); err != nil {
+			continue
+		}
+		locks = append(locks, &lock)
+	}
+
+	return locks, nil
+}
+
+func (f *Filesystem) uploadPath(id string) string {
+	return filepath.Join(f.basePath, "uploads", id)
+}
+
+func (f *Filesystem) uploadStatePath(id string) string {
+	return filepath.Join(f.basePath, "uploads", id+".json")
+}
+
+// saveUpload atomically replaces the state of an upload
+func (f *Filesystem) saveUpload(upload *Upload) error {
+	tmp, err := os.CreateTemp(filepath.Join(f.basePath, "uploads"), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create upload state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := json.NewEncoder(tmp).Encode(upload); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.uploadStatePath(upload.ID)); err != nil {
+		return fmt.Errorf("failed to store upload state: %w", err)
+	}
+	return nil
+}
+
+// CreateUpload stages a new, empty upload
+func (f *Filesystem) CreateUpload(ctx context.Context, upload *Upload) error {
+	file, err := os.OpenFile(f.uploadPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	file.Close()
+
+	if err := f.saveUpload(upload); err != nil {
+		os.Remove(f.uploadPath(upload.ID))
+		return err
+	}
+	return nil
+}
+
+// GetUpload returns the state of a staged upload
+func (f *Filesystem) GetUpload(ctx context.Context, id string) (*Upload, error) {
+	data, err := os.ReadFile(f.uploadStatePath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, fmt.Errorf("failed to read upload state: %w", err)
+	}
+
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to read upload state: %w", err)
+	}
+	return &upload, nil
+}
+
+// AppendUpload writes content at the upload's offset. Bytes past the offset
+// left by an append that failed to store its state are overwritten.
+func (f *Filesystem) AppendUpload(ctx context.Context, upload *Upload, content io.Reader) error {
+	file, err := os.OpenFile(f.uploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrUploadNotFound
+		}
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(upload.Offset); err != nil {
+		return fmt.Errorf("failed to truncate upload: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek upload: %w", err)
+	}
+
+	n, copyErr := io.Copy(file, content)
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to write upload: %w", err)
+	}
+	upload.Offset += n
+	if err := f.saveUpload(upload); err != nil {
+		return err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to write upload: %w", copyErr)
+	}
+	return nil
+}
+
+// CommitUpload stores a complete upload as an item
+func (f *Filesystem) CommitUpload(ctx context.Context, upload *Upload) error {
+	file, err := os.Open(f.uploadPath(upload.ID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrUploadNotFound
+		}
+		return fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	if err := f.Put(ctx, upload.ID, file, upload.Item); err != nil {
+		return err
+	}
+	return f.DeleteUpload(ctx, upload.ID)
+}
+
+// DeleteUpload removes a staged upload and its state
+func (f *Filesystem) DeleteUpload(ctx context.Context, id string) error {
+	if err := os.Remove(f.uploadStatePath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete upload state: %w", err)
+	}
+	if err := os.Remove(f.uploadPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// ListUploads returns all staged uploads
+func (f *Filesystem) ListUploads(ctx context.Context) ([]*Upload, error) {
+	entries, err := os.ReadDir(filepath.Join(f.basePath, "uploads"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload directory: %w", err)
+	}
+
+	var uploads []*Upload
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		upload, err := f.GetUpload(ctx, strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		uploads = append(uploads, upload)
+	}
+	return uploads, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrLockExists is returned by CreateLock when the resource is already locked
+var ErrLockExists = errors.New("lock already exists")
+
+// Lock represents a persisted WebDAV lock
+type Lock struct {
+	Token     string        `json:"token"`
+	Root      string        `json:"root"`
+	ZeroDepth bool          `json:"zero_depth"`
+	OwnerXML  string        `json:"owner_xml,omitempty"`
+	Duration  time.Duration `json:"duration"` // as requested by the client, negative means infinite
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+// Expired reports whether the lock has expired at the given time
+func (l *Lock) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// LockStore persists WebDAV locks so they survive restarts and can be
+// shared between server instances using the same backend.
+// Locks are keyed by their root path, at most one lock exists per root.
+type LockStore interface {
+	// CreateLock stores a new lock, returning ErrLockExists if the root is already locked
+	CreateLock(ctx context.Context, lock *Lock) error
+
+	// UpdateLock overwrites an existing lock
+	UpdateLock(ctx context.Context, lock *Lock) error
+
+	// DeleteLock removes a lock, unless its root was locked again with
+	// another token since it was read
+	DeleteLock(ctx context.Context, lock *Lock) error
+
+	// ListLocks returns all stored locks, including expired ones
+	ListLocks(ctx context.Context) ([]*Lock, error)
+}
+
+// lockKey maps a lock root path to a name safe for use as a file or object key
+func lockKey(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return hex.EncodeToString(sum[:16])
+}
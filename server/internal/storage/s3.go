@@ -3,15 +3,24 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
 
 	"github.com/Fileri/share/server/internal/config"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
 // S3Storage implements Storage using S3-compatible backends
@@ -73,15 +82,44 @@ func (s *S3Storage) metaKey(id string) string {
 	return "meta/" + id + ".json"
 }
 
+func (s *S3Storage) derivedKey(id string, name string) string {
+	return "derived/" + id + "/" + name
+}
+
 // Put stores a file and its metadata
 func (s *S3Storage) Put(ctx context.Context, id string, content io.Reader, item *Item) error {
 	// Read content into buffer to get size
 	var buf bytes.Buffer
-	size, err := io.Copy(&buf, content)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(&buf, hash), content)
 	if err != nil {
 		return fmt.Errorf("failed to read content: %w", err)
 	}
 	item.Size = size
+	item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	// Content replaced under the same ID is copied aside until the new
+	// metadata is stored, and put back if it can't be
+	previous := s.fileKey(id) + ".previous"
+	_, err = s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.metaKey(id)),
+	})
+	replacing := err == nil
+	if replacing {
+		_, err = s.client.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(previous),
+			CopySource: aws.String(s.bucket + "/" + s.fileKey(id)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to keep replaced file: %w", err)
+		}
+		defer s.client.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(previous),
+		})
+	}
 
 	// Upload file
 	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
@@ -95,6 +133,29 @@ func (s *S3Storage) Put(ctx context.Context, id string, content io.Reader, item
 	}
 
 	// Upload metadata
+	if err := s.putMeta(ctx, id, item); err != nil {
+		// Try to put back the replaced file, or clean up the new one
+		if replacing {
+			s.client.CopyObject(ctx, &s3.CopyObjectInput{
+				Bucket:     aws.String(s.bucket),
+				Key:        aws.String(s.fileKey(id)),
+				CopySource: aws.String(s.bucket + "/" + previous),
+			})
+		} else {
+			s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(s.fileKey(id)),
+			})
+		}
+		return err
+	}
+
+	return nil
+}
+
+// putMeta writes the metadata of an item. Objects are replaced as a whole,
+// so readers never see it half-written.
+func (s *S3Storage) putMeta(ctx context.Context, id string, item *Item) error {
 	metaBytes, err := json.Marshal(item)
 	if err != nil {
 		return fmt.Errorf("failed to marshal metadata: %w", err)
@@ -107,14 +168,51 @@ func (s *S3Storage) Put(ctx context.Context, id string, content io.Reader, item
 		ContentType: aws.String("application/json"),
 	})
 	if err != nil {
-		// Try to clean up the file
-		s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		return fmt.Errorf("failed to upload metadata: %w", err)
+	}
+	return nil
+}
+
+// UpdateMeta replaces the metadata of an existing item. The write only
+// succeeds if the metadata is still the one read, so an item changed or
+// deleted in the meantime, also through another instance, is not overwritten
+// or brought back.
+func (s *S3Storage) UpdateMeta(ctx context.Context, id string, item *Item) error {
+	etag := item.version
+	if etag == "" {
+		head, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 			Bucket: aws.String(s.bucket),
-			Key:    aws.String(s.fileKey(id)),
+			Key:    aws.String(s.metaKey(id)),
 		})
-		return fmt.Errorf("failed to upload metadata: %w", err)
+		if err != nil {
+			return fmt.Errorf("item not found")
+		}
+		etag = aws.ToString(head.ETag)
 	}
 
+	metaBytes, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	result, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.metaKey(id)),
+		Body:        bytes.NewReader(metaBytes),
+		ContentType: aws.String("application/json"),
+	}, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", etag)))
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) {
+			switch respErr.HTTPStatusCode() {
+			case http.StatusNotFound:
+				return fmt.Errorf("item not found")
+			case http.StatusPreconditionFailed, http.StatusConflict:
+				return ErrItemChanged
+			}
+		}
+		return fmt.Errorf("failed to upload metadata: %w", err)
+	}
+	item.version = aws.ToString(result.ETag)
 	return nil
 }
 
@@ -136,6 +234,19 @@ func (s *S3Storage) Get(ctx context.Context, id string) (io.ReadCloser, *Item, e
 	return result.Body, item, nil
 }
 
+// GetRange retrieves part of a file with a ranged GET
+func (s *S3Storage) GetRange(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.fileKey(id)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file range: %w", err)
+	}
+	return result.Body, nil
+}
+
 // GetMeta retrieves only the metadata
 func (s *S3Storage) GetMeta(ctx context.Context, id string) (*Item, error) {
 	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
@@ -151,11 +262,12 @@ func (s *S3Storage) GetMeta(ctx context.Context, id string) (*Item, error) {
 	if err := json.NewDecoder(result.Body).Decode(&item); err != nil {
 		return nil, fmt.Errorf("failed to decode metadata: %w", err)
 	}
+	item.version = aws.ToString(result.ETag)
 
 	return &item, nil
 }
 
-// Delete removes a file and its metadata
+// Delete removes a file, its metadata and derived artifacts
 func (s *S3Storage) Delete(ctx context.Context, id string) error {
 	// Delete both objects
 	s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -166,6 +278,66 @@ func (s *S3Storage) Delete(ctx context.Context, id string) error {
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(s.metaKey(id)),
 	})
+
+	// Delete derived artifacts
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.derivedKey(id, "")),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			break
+		}
+		for _, obj := range page.Contents {
+			s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    obj.Key,
+			})
+		}
+	}
+	return nil
+}
+
+// PutDerived stores an artifact generated from an item
+func (s *S3Storage) PutDerived(ctx context.Context, id string, name string, content io.Reader) error {
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, content); err != nil {
+		return fmt.Errorf("failed to read derived content: %w", err)
+	}
+
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.derivedKey(id, name)),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload derived file: %w", err)
+	}
+	return nil
+}
+
+// GetDerived retrieves an artifact generated from an item
+func (s *S3Storage) GetDerived(ctx context.Context, id string, name string) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.derivedKey(id, name)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get derived file: %w", err)
+	}
+	return result.Body, nil
+}
+
+// DeleteDerived removes an artifact generated from an item
+func (s *S3Storage) DeleteDerived(ctx context.Context, id string, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.derivedKey(id, name)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete derived file: %w", err)
+	}
 	return nil
 }
 
@@ -204,3 +376,454 @@ func (s *S3Storage) List(ctx context.Context, ownerToken string) ([]*Item, error
 
 	return items, nil
 }
+
+func (s *S3Storage) lockKey(root string) string {
+	return "locks/" + lockKey(root) + ".json"
+}
+
+func (s *S3Storage) putLock(ctx context.Context, lock *Lock, exclusive bool) error {
+	lockBytes, err := json.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock: %w", err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.lockKey(lock.Root)),
+		Body:        bytes.NewReader(lockBytes),
+		ContentType: aws.String("application/json"),
+	}
+	if exclusive {
+		// Conditional write so that only one instance can create the lock
+		input.IfNoneMatch = aws.String("*")
+	}
+
+	_, err = s.client.PutObject(ctx, input)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if exclusive && errors.As(err, &respErr) {
+			switch respErr.HTTPStatusCode() {
+			case http.StatusPreconditionFailed, http.StatusConflict:
+				return ErrLockExists
+			}
+		}
+		return fmt.Errorf("failed to upload lock: %w", err)
+	}
+	return nil
+}
+
+// CreateLock stores a new lock using a conditional write
+func (s *S3Storage) CreateLock(ctx context.Context, lock *Lock) error {
+	return s.putLock(ctx, lock, true)
+}
+
+// UpdateLock overwrites an existing lock
+func (s *S3Storage) UpdateLock(ctx context.Context, lock *Lock) error {
+	return s.putLock(ctx, lock, false)
+}
+
+// DeleteLock removes a lock if it is still stored with the same token. The
+// delete is conditional on the version read, so a lock taken on the root in
+// between, also through another instance, is kept.
+func (s *S3Storage) DeleteLock(ctx context.Context, lock *Lock) error {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.lockKey(lock.Root)),
+	})
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("failed to get lock: %w", err)
+	}
+	var stored Lock
+	err = json.NewDecoder(result.Body).Decode(&stored)
+	result.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode lock: %w", err)
+	}
+	if stored.Token != lock.Token {
+		return nil
+	}
+
+	_, err = s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.lockKey(lock.Root)),
+	}, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", aws.ToString(result.ETag))))
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) {
+			switch respErr.HTTPStatusCode() {
+			case http.StatusNotFound, http.StatusPreconditionFailed, http.StatusConflict:
+				return nil
+			}
+		}
+		return fmt.Errorf("failed to delete lock: %w", err)
+	}
+	return nil
+}
+
+// ListLocks returns all stored locks
+func (s *S3Storage) ListLocks(ctx context.Context) ([]*Lock, error) {
+	var locks []*Lock
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String("locks/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list locks: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				continue
+			}
+
+			var lock Lock
+			err = json.NewDecoder(result.Body).Decode(&lock)
+			result.Body.Close()
+			if err != nil {
+				continue
+			}
+			locks = append(locks, &lock)
+		}
+	}
+
+	return locks, nil
+}
+
+func (s *S3Storage) uploadKey(id string) string {
+	return "uploads/" + id + ".json"
+}
+
+// uploadPartSize is the most of a chunk held in memory at once, larger
+// chunks are staged as several parts. Committed uploads are stored in parts
+// of the same size.
+const uploadPartSize = 16 << 20
+
+// uploadPartKey names a new chunk of an upload, since objects cannot be
+// appended to. Every write gets a key of its own, only the parts listed in
+// the upload's state belong to it.
+func (s *S3Storage) uploadPartKey(id string, offset int64) string {
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return fmt.Sprintf("uploads/%s/%020d-%s", id, offset, hex.EncodeToString(suffix))
+}
+
+// putUpload writes the state of an upload. A state that was read or written
+// before is only replaced if it is still the same, which orders requests
+// appending to the upload through several instances.
+func (s *S3Storage) putUpload(ctx context.Context, upload *Upload) error {
+	uploadBytes, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload: %w", err)
+	}
+
+	var opts []func(*s3.Options)
+	if upload.etag != "" {
+		opts = append(opts, s3.WithAPIOptions(smithyhttp.AddHeaderValue("If-Match", upload.etag)))
+	}
+	result, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.uploadKey(upload.ID)),
+		Body:        bytes.NewReader(uploadBytes),
+		ContentType: aws.String("application/json"),
+	}, opts...)
+	if err != nil {
+		var respErr *awshttp.ResponseError
+		if errors.As(err, &respErr) {
+			switch respErr.HTTPStatusCode() {
+			case http.StatusNotFound:
+				return ErrUploadNotFound
+			case http.StatusPreconditionFailed, http.StatusConflict:
+				return ErrUploadConflict
+			}
+		}
+		return fmt.Errorf("failed to upload upload state: %w", err)
+	}
+	upload.etag = aws.ToString(result.ETag)
+	return nil
+}
+
+// CreateUpload stages a new, empty upload
+func (s *S3Storage) CreateUpload(ctx context.Context, upload *Upload) error {
+	return s.putUpload(ctx, upload)
+}
+
+// GetUpload returns the state of a staged upload
+func (s *S3Storage) GetUpload(ctx context.Context, id string) (*Upload, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.uploadKey(id)),
+	})
+	if err != nil {
+		return nil, ErrUploadNotFound
+	}
+	defer result.Body.Close()
+
+	var upload Upload
+	if err := json.NewDecoder(result.Body).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload state: %w", err)
+	}
+	upload.etag = aws.ToString(result.ETag)
+	return &upload, nil
+}
+
+// AppendUpload stores content as the next parts of the upload. A part only
+// belongs to the upload once its state lists it, so a part written by a
+// request that failed before is never used, and of two requests appending at
+// once only one succeeds.
+func (s *S3Storage) AppendUpload(ctx context.Context, upload *Upload, content io.Reader) error {
+	buf := make([]byte, min(uploadPartSize, max(upload.Length-upload.Offset, 1)))
+	for {
+		n, readErr := io.ReadFull(content, buf)
+		if n > 0 {
+			key := s.uploadPartKey(upload.ID, upload.Offset)
+			_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    aws.String(key),
+				Body:   bytes.NewReader(buf[:n]),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to upload part: %w", err)
+			}
+			upload.Parts = append(upload.Parts, key)
+			upload.Offset += int64(n)
+			if err := s.putUpload(ctx, upload); err != nil {
+				s.client.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+					Bucket: aws.String(s.bucket),
+					Key:    aws.String(key),
+				})
+				return err
+			}
+		}
+
+		switch {
+		case readErr == io.EOF || readErr == io.ErrUnexpectedEOF:
+			return nil
+		case readErr != nil:
+			return fmt.Errorf("failed to read content: %w", readErr)
+		}
+	}
+}
+
+// CommitUpload stores a complete upload as an item. Its parts are read one
+// at a time into the parts of the stored file, so it is never held in memory
+// as a whole.
+func (s *S3Storage) CommitUpload(ctx context.Context, upload *Upload) error {
+	parts := &partsReader{ctx: ctx, s: s, upload: upload}
+	defer parts.Close()
+
+	if err := s.putFile(ctx, upload.ID, parts, upload.Item); err != nil {
+		return err
+	}
+	if err := s.putMeta(ctx, upload.ID, upload.Item); err != nil {
+		s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.fileKey(upload.ID)),
+		})
+		return err
+	}
+	return s.DeleteUpload(ctx, upload.ID)
+}
+
+// putFile stores the content of a new item, as a multipart upload if it is
+// larger than uploadPartSize, and sets its size and hash
+func (s *S3Storage) putFile(ctx context.Context, id string, content io.Reader, item *Item) error {
+	hash := sha256.New()
+	buf := make([]byte, uploadPartSize)
+	n, readErr := io.ReadFull(content, buf)
+	item.Size = int64(n)
+	hash.Write(buf[:n])
+
+	// Content that fits in one part is stored as is
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.bucket),
+			Key:         aws.String(s.fileKey(id)),
+			Body:        bytes.NewReader(buf[:n]),
+			ContentType: aws.String(item.ContentType),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+		item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed to read content: %w", readErr)
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.fileKey(id)),
+		ContentType: aws.String(item.ContentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to start file upload: %w", err)
+	}
+	abort := func() {
+		s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(s.fileKey(id)),
+			UploadId: created.UploadId,
+		})
+	}
+
+	var completed []types.CompletedPart
+	for n > 0 {
+		number := aws.Int32(int32(len(completed) + 1))
+		part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(s.fileKey(id)),
+			UploadId:   created.UploadId,
+			PartNumber: number,
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			abort()
+			return fmt.Errorf("failed to upload file part: %w", err)
+		}
+		completed = append(completed, types.CompletedPart{ETag: part.ETag, PartNumber: number})
+
+		n, readErr = io.ReadFull(content, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			abort()
+			return fmt.Errorf("failed to read content: %w", readErr)
+		}
+		item.Size += int64(n)
+		hash.Write(buf[:n])
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(s.fileKey(id)),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		abort()
+		return fmt.Errorf("failed to complete file upload: %w", err)
+	}
+	item.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// partsReader reads the parts of an upload in order, fetching each when
+// the previous one is done
+type partsReader struct {
+	ctx     context.Context
+	s       *S3Storage
+	upload  *Upload
+	part    int
+	current io.ReadCloser
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for {
+		if p.current == nil {
+			if p.part >= len(p.upload.Parts) {
+				return 0, io.EOF
+			}
+			result, err := p.s.client.GetObject(p.ctx, &s3.GetObjectInput{
+				Bucket: aws.String(p.s.bucket),
+				Key:    aws.String(p.upload.Parts[p.part]),
+			})
+			p.part++
+			if err != nil {
+				return 0, fmt.Errorf("failed to get upload part: %w", err)
+			}
+			p.current = result.Body
+		}
+
+		n, err := p.current.Read(b)
+		if err == io.EOF {
+			p.current.Close()
+			p.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.current != nil {
+		return p.current.Close()
+	}
+	return nil
+}
+
+// DeleteUpload removes a staged upload, its state first so it is no longer
+// found while its parts are removed
+func (s *S3Storage) DeleteUpload(ctx context.Context, id string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.uploadKey(id)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete upload state: %w", err)
+	}
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String("uploads/" + id + "/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list upload parts: %w", err)
+		}
+		for _, obj := range page.Contents {
+			s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(s.bucket),
+				Key:    obj.Key,
+			})
+		}
+	}
+	return nil
+}
+
+// ListUploads returns all staged uploads
+func (s *S3Storage) ListUploads(ctx context.Context) ([]*Upload, error) {
+	var uploads []*Upload
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String("uploads/"),
+		Delimiter: aws.String("/"),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list uploads: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			id, ok := strings.CutSuffix(strings.TrimPrefix(key, "uploads/"), ".json")
+			if !ok {
+				continue
+			}
+			upload, err := s.GetUpload(ctx, id)
+			if err != nil {
+				continue
+			}
+			uploads = append(uploads, upload)
+		}
+	}
+
+	return uploads, nil
+}
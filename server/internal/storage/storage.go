@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -9,15 +10,65 @@ import (
 	"github.com/Fileri/share/server/internal/config"
 )
 
+// ErrItemChanged is returned by UpdateMeta when the metadata of the item was
+// replaced since it was read
+var ErrItemChanged = errors.New("item changed since it was read")
+
 // Item represents a stored file
 type Item struct {
-	ID          string    `json:"id"`
+	ID          string     `json:"id"`
+	Filename    string     `json:"filename,omitempty"`
+	ContentType string     `json:"content_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `json:"sha256,omitempty"`      // hex digest of the content, set by Put
+	RenderMode  string     `json:"render_mode"`           // "auto", "raw", "render"
+	Theme       string     `json:"theme,omitempty"`       // color theme of the rendered view, empty for the server default
+	NoPreview   bool       `json:"no_preview,omitempty"`  // hide from link unfurling: no OpenGraph tags or oEmbed
+	Description string     `json:"description,omitempty"` // shown in link previews instead of an excerpt
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`  // nil if the item does not expire
+	MaxViews    int        `json:"max_views,omitempty"`   // times the item can be opened, 0 for unlimited
+	Collection  string     `json:"collection,omitempty"`  // ID of the collection the item was shared in, if any
+	Revision    int        `json:"revision,omitempty"`    // number of the current version, 0 for items never replaced
+	Revisions   []Revision `json:"revisions,omitempty"`   // previous versions that are kept, oldest first
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`  // when the content was last replaced, nil if never
+	OwnerToken  string     `json:"owner_token,omitempty"` // stored but not exposed in API responses
+	Password    string     `json:"password,omitempty"`    // salted hash of the password viewers need, empty for none
+
+	version string // of the metadata as read, which UpdateMeta expects to be unchanged
+}
+
+// Expired reports whether the item has expired at the given time
+func (i *Item) Expired(now time.Time) bool {
+	return i.ExpiresAt != nil && !now.Before(*i.ExpiresAt)
+}
+
+// Revision is a previous version of an item's content, stored as a derived
+// artifact of the item
+type Revision struct {
+	Number      int       `json:"number"`
 	Filename    string    `json:"filename,omitempty"`
 	ContentType string    `json:"content_type"`
 	Size        int64     `json:"size"`
-	RenderMode  string    `json:"render_mode"` // "auto", "raw", "render"
-	CreatedAt   time.Time `json:"created_at"`
-	OwnerToken  string    `json:"owner_token,omitempty"` // stored but not exposed in API responses
+	SHA256      string    `json:"sha256,omitempty"`
+	CreatedAt   time.Time `json:"created_at"` // when this version was stored
+}
+
+// CurrentRevision returns the number of the item's current version, counting
+// the original upload as 1
+func (i *Item) CurrentRevision() int {
+	return max(i.Revision, 1)
+}
+
+// FindRevision returns a kept previous version, nil if there is none by the
+// number
+func (i *Item) FindRevision(number int) *Revision {
+	for j := range i.Revisions {
+		if i.Revisions[j].Number == number {
+			return &i.Revisions[j]
+		}
+	}
+	return nil
 }
 
 // Storage defines the interface for file storage backends
@@ -31,13 +82,35 @@ type Storage interface {
 	// GetMeta retrieves only metadata
 	GetMeta(ctx context.Context, id string) (*Item, error)
 
-	// Delete removes a file
+	// Delete removes a file along with its derived artifacts
 	Delete(ctx context.Context, id string) error
 
+	// PutDerived stores an artifact generated from an item, such as a thumbnail
+	PutDerived(ctx context.Context, id string, name string, content io.Reader) error
+
+	// GetDerived retrieves an artifact generated from an item
+	GetDerived(ctx context.Context, id string, name string) (io.ReadCloser, error)
+
+	// DeleteDerived removes an artifact, which is not an error if it does
+	// not exist
+	DeleteDerived(ctx context.Context, id string, name string) error
+
+	// UpdateMeta replaces the metadata of an existing item, leaving its
+	// content as is. It returns ErrItemChanged if the metadata was replaced
+	// since the item was read.
+	UpdateMeta(ctx context.Context, id string, item *Item) error
+
 	// List returns all items for a given owner token
 	List(ctx context.Context, ownerToken string) ([]*Item, error)
 }
 
+// RangeStore is implemented by backends that can read part of a file without
+// fetching all of it, used to open large archives in place
+type RangeStore interface {
+	// GetRange retrieves length bytes of a file's content from offset on
+	GetRange(ctx context.Context, id string, offset int64, length int64) (io.ReadCloser, error)
+}
+
 // New creates a new storage backend based on configuration
 func New(cfg config.StorageConfig) (Storage, error) {
 	switch cfg.Type {
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrUploadNotFound is returned for uploads that do not exist, or no longer
+// do since they were committed or removed
+var ErrUploadNotFound = errors.New("upload not found")
+
+// ErrUploadConflict is returned by AppendUpload when another request appended
+// to the upload since it was read
+var ErrUploadConflict = errors.New("upload appended to concurrently")
+
+// Upload is a resumable upload in progress. Its content is staged apart from
+// items, so it is neither listed nor served until committed.
+type Upload struct {
+	ID        string    `json:"id"`
+	Length    int64     `json:"length"`              // total size declared by the client
+	Offset    int64     `json:"offset"`              // bytes received so far
+	Parts     []string  `json:"part_keys,omitempty"` // chunks staged in order, for backends that cannot append
+	Item      *Item     `json:"item"`                // metadata of the item the upload becomes
+	Strip     bool      `json:"strip,omitempty"`     // remove image metadata when committed
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	etag string // version of the state as read or written, for backends that replace it conditionally
+}
+
+// Expired reports whether the upload has expired at the given time
+func (u *Upload) Expired(now time.Time) bool {
+	return !now.Before(u.ExpiresAt)
+}
+
+// Complete reports whether all of the upload was received
+func (u *Upload) Complete() bool {
+	return u.Offset >= u.Length
+}
+
+// UploadStore stages resumable uploads in the storage backend, so they
+// survive restarts and can be continued through any server instance.
+type UploadStore interface {
+	// CreateUpload stages a new, empty upload
+	CreateUpload(ctx context.Context, upload *Upload) error
+
+	// GetUpload returns the state of a staged upload
+	GetUpload(ctx context.Context, id string) (*Upload, error)
+
+	// AppendUpload adds content at the upload's offset and stores the new
+	// offset. What was received is kept if reading content fails partway.
+	// Content is not held in memory as a whole.
+	AppendUpload(ctx context.Context, upload *Upload, content io.Reader) error
+
+	// CommitUpload stores a complete upload as an item with the same ID, and
+	// removes what was staged
+	CommitUpload(ctx context.Context, upload *Upload) error
+
+	// DeleteUpload removes a staged upload
+	DeleteUpload(ctx context.Context, id string) error
+
+	// ListUploads returns all staged uploads, including expired ones
+	ListUploads(ctx context.Context) ([]*Upload, error)
+}
@@ -0,0 +1,52 @@
+#!/bin/sh
+# Downloads the third-party libraries used by rendered views into the embedded
+# assets: pdf.js for PDFs, Mermaid, Viz.js and KaTeX for diagrams and math in
+# Markdown. Run before `go build`; views fall back to simpler output without them.
+# Each tarball is checked against the npm integrity pinned in assets.integrity,
+# so changing a version also takes pinning its integrity.
+set -eu
+
+PDFJS_VERSION="${PDFJS_VERSION:-4.10.38}"
+MERMAID_VERSION="${MERMAID_VERSION:-11.4.1}"
+VIZ_VERSION="${VIZ_VERSION:-3.11.0}"
+KATEX_VERSION="${KATEX_VERSION:-0.16.21}"
+
+DEST="$(dirname "$0")/../internal/render/assets"
+PINS="$(dirname "$0")/assets.integrity"
+TMP="$(mktemp -d)"
+trap 'rm -rf "$TMP"' EXIT
+
+# fetch <package> <version> downloads an npm package, checks it against the
+# integrity pinned in $PINS and unpacks it into $TMP/<package>
+fetch() {
+    expected="$(awk -v p="$1" -v v="$2" '$1 == p && $2 == v { print $3 }' "$PINS")"
+    if [ -z "$expected" ]; then
+        echo "No integrity pinned for $1@$2 in $PINS, add the output of: npm view $1@$2 dist.integrity" >&2
+        exit 1
+    fi
+
+    mkdir -p "$TMP/$1"
+    wget -qO "$TMP/$1.tgz" "https://registry.npmjs.org/$1/-/$(basename "$1")-$2.tgz"
+    actual="sha512-$(openssl dgst -sha512 -binary "$TMP/$1.tgz" | openssl base64 -A)"
+    if [ "$actual" != "$expected" ]; then
+        echo "Integrity mismatch for $1@$2: expected $expected, got $actual" >&2
+        exit 1
+    fi
+    tar -xzf "$TMP/$1.tgz" -C "$TMP/$1"
+}
+
+fetch pdfjs-dist "$PDFJS_VERSION"
+cp "$TMP/pdfjs-dist/package/build/pdf.min.mjs" "$TMP/pdfjs-dist/package/build/pdf.worker.min.mjs" "$DEST/"
+
+fetch mermaid "$MERMAID_VERSION"
+cp "$TMP/mermaid/package/dist/mermaid.min.js" "$DEST/"
+
+fetch @viz-js/viz "$VIZ_VERSION"
+cp "$TMP/@viz-js/viz/package/lib/viz-standalone.js" "$DEST/"
+
+# Fonts are stored next to the stylesheet, which is rewritten to their URLs at startup
+fetch katex "$KATEX_VERSION"
+cp "$TMP/katex/package/dist/katex.min.js" "$TMP/katex/package/dist/katex.min.css" "$DEST/"
+cp "$TMP"/katex/package/dist/fonts/*.woff2 "$DEST/"
+
+echo "Assets installed in $DEST"